@@ -0,0 +1,83 @@
+package env
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// An Audio Track from the Original to include in the Encoded Video
+type AudioTrack struct {
+	Track  int     `json:"track"`  // Position amongst the Audio Streams of the Original, starting from 0
+	Volume float64 `json:"volume"` // Multiplier for the Track's Volume, 1 leaves it unchanged
+}
+
+// Tracks sent without a Volume keep their original volume instead of being muted
+func (t *AudioTrack) UnmarshalJSON(b []byte) error {
+	type plain AudioTrack
+	p := plain{Volume: 1}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	*t = AudioTrack(p)
+	return nil
+}
+
+// How the Audio of a Video is Encoded, chosen by the Uploader
+// - Stored as JSON in the database
+type VideoAudio struct {
+	Tracks   []AudioTrack `json:"tracks"`   // Tracks to include, empty includes every track at its original volume
+	Separate bool         `json:"separate"` // Keep each Track as its own Stream instead of merging them?
+}
+
+// Are the Tracks usable? Whether they exist is only known once the video is probed
+func (a VideoAudio) Valid() bool {
+	if len(a.Tracks) > AUDIO_STREAMS_LIMIT {
+		return false
+	}
+	seen := map[int]bool{}
+	for _, t := range a.Tracks {
+		if t.Track < 0 || seen[t.Track] || t.Volume < 0 || t.Volume > 10 || math.IsNaN(t.Volume) {
+			return false
+		}
+		seen[t.Track] = true
+	}
+	return true
+}
+
+// Resolve the Tracks to Encode given how many Audio Streams the Original has
+// - Silent videos have no tracks unless some were chosen, which is an error
+func (a VideoAudio) resolve(available int) ([]AudioTrack, error) {
+	if len(a.Tracks) == 0 {
+		tracks := []AudioTrack{}
+		for i := 0; i < min(available, AUDIO_STREAMS_LIMIT); i++ {
+			tracks = append(tracks, AudioTrack{Track: i, Volume: 1})
+		}
+		return tracks, nil
+	}
+	for _, t := range a.Tracks {
+		if t.Track >= available {
+			return nil, fmt.Errorf("track %d was chosen but the video has %d audio tracks", t.Track, available)
+		}
+	}
+	return a.Tracks, nil
+}
+
+func (a *VideoAudio) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	case []byte:
+		return json.Unmarshal(v, a)
+	case nil:
+		*a = VideoAudio{}
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into VideoAudio", src)
+}
+
+func (a VideoAudio) Value() (driver.Value, error) {
+	b, err := json.Marshal(a)
+	return string(b), err
+}
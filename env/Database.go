@@ -3,9 +3,11 @@ package env
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"path"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,8 +21,16 @@ var (
 	databaseSchema  string
 	databaseStarted sync.Once
 	DB              *sql.DB
+	databaseUsers   sync.WaitGroup // Background work that must finish before the Database is closed
 )
 
+// Keep the Database open after stop is cancelled until release is called
+// - Must be called before stop is cancelled
+func HoldDatabase() (release func()) {
+	databaseUsers.Add(1)
+	return databaseUsers.Done
+}
+
 func StartDatabase(stop context.Context, await *sync.WaitGroup) {
 	databaseStarted.Do(func() {
 		t := time.Now()
@@ -40,7 +50,7 @@ func StartDatabase(stop context.Context, await *sync.WaitGroup) {
 
 		// Open Database
 		var err error
-		DB, err = sql.Open("sqlite3", p)
+		DB, err = sql.Open("sqlite3", p+"?_foreign_keys=on")
 		if err != nil {
 			log.Fatalln("[env/db] Open Database Error:", err)
 		}
@@ -50,15 +60,36 @@ func StartDatabase(stop context.Context, await *sync.WaitGroup) {
 		}
 
 		// Apply Schema
-		if _, err := DB.Exec(databaseSchema); err != nil {
-			log.Fatalln("[env/db] Cannot Apply Schema:", err)
+		// Each "-- Version" section is applied once and tracked using the user_version pragma
+		var schemaVersion int
+		if err := DB.QueryRow("PRAGMA user_version").Scan(&schemaVersion); err != nil {
+			log.Fatalln("[env/db] Cannot Read Schema Version:", err)
+		}
+		schemaSections := strings.Split(databaseSchema, "\n-- Version ")[1:]
+		for i := schemaVersion; i < len(schemaSections); i++ {
+			tx, err := DB.Begin()
+			if err != nil {
+				log.Fatalln("[env/db] Cannot Apply Schema:", err)
+			}
+			if _, err := tx.Exec("-- Version " + schemaSections[i]); err != nil {
+				log.Fatalln("[env/db] Cannot Apply Schema:", err)
+			}
+			if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+				log.Fatalln("[env/db] Cannot Apply Schema:", err)
+			}
+			if err := tx.Commit(); err != nil {
+				log.Fatalln("[env/db] Cannot Apply Schema:", err)
+			}
+			log.Println("[env/db] Applied Schema Version", strings.SplitN(schemaSections[i], " ", 2)[0])
 		}
+		backfillSizes()
 
 		// Shutdown Logic
 		await.Add(1)
 		go func() {
 			defer await.Done()
 			<-stop.Done()
+			databaseUsers.Wait()
 			DB.Close()
 			log.Println("[env/db] Database Closed")
 		}()
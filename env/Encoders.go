@@ -1,16 +1,17 @@
 package env
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"io/fs"
 	"log"
 	"math"
 	"os"
 	"os/exec"
 	"path"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -34,375 +35,775 @@ var (
 	AUDIO_BITRATE             = EnvString("ENCODER_AUDIO_BITRATE", "320K")
 	AUDIO_CODEC               = EnvString("ENCODER_AUDIO_CODEC", "aac")
 	AUDIO_CHANNELS            = EnvString("ENCODER_AUDIO_CHANNELS", "2")
+	AUDIO_NORMALIZE           = EnvString("ENCODER_AUDIO_NORMALIZE", "false") == "true"
+	HLS_ENABLED               = EnvString("ENCODER_HLS_ENABLED", "false") == "true"
+	HLS_RENDITIONS            = EnvString("ENCODER_HLS_RENDITIONS", "1080,720,480")
+	HLS_SEGMENT_LENGTH        = EnvNumber("ENCODER_HLS_SEGMENT_LENGTH", 4)
+	OUTPUT_FILENAME_PLAYLIST  = EnvString("ENCODER_OUTPUT_FILENAME_PLAYLIST", "master.m3u8")
+	OUTPUT_FILENAME_SPRITES   = EnvString("ENCODER_OUTPUT_FILENAME_SPRITES", "sprites.jpg")
+	OUTPUT_FILENAME_VTT       = EnvString("ENCODER_OUTPUT_FILENAME_VTT", "storyboard.vtt")
+	THUMBNAIL_POSITION        = EnvNumber("ENCODER_THUMBNAIL_POSITION", 10)
+	SPRITES_ENABLED           = EnvString("ENCODER_SPRITES_ENABLED", "true") == "true"
+	SPRITES_INTERVAL          = EnvNumber("ENCODER_SPRITES_INTERVAL", 5)
+	SPRITES_LIMIT             = EnvNumber("ENCODER_SPRITES_LIMIT", 100)
+	SPRITES_HEIGHT            = EnvNumber("ENCODER_SPRITES_HEIGHT", 90)
+	OUTPUT_FILENAME_ANIMATED  = EnvString("ENCODER_OUTPUT_FILENAME_ANIMATED", "animated.gif")
+	ANIMATED_ENABLED          = EnvString("ENCODER_ANIMATED_ENABLED", "false") == "true"
+	ANIMATED_DURATION         = EnvNumber("ENCODER_ANIMATED_DURATION", 3)
+	ANIMATED_OFFSET           = EnvNumber("ENCODER_ANIMATED_OFFSET", 10)
+	ANIMATED_HEIGHT           = EnvNumber("ENCODER_ANIMATED_HEIGHT", 240)
+	ANIMATED_FPS              = EnvNumber("ENCODER_ANIMATED_FPS", 15)
+	RETRY_LIMIT               = EnvNumber("ENCODER_RETRY_LIMIT", 3)
+	RETRY_DELAY               = EnvNumber("ENCODER_RETRY_DELAY", 30)
+	LIMIT_TIMEOUT             = EnvNumber("ENCODER_LIMIT_TIMEOUT", 300)
+	LIMIT_TIMEOUT_RATIO       = EnvNumber("ENCODER_LIMIT_TIMEOUT_RATIO", 10)
+	LIMIT_TIMEOUT_MAX         = EnvNumber("ENCODER_LIMIT_TIMEOUT_MAX", 21600)
+	LIMIT_DURATION            = EnvNumber("ENCODER_LIMIT_DURATION", 0)
+	LIMIT_PIXELS              = EnvNumber("ENCODER_LIMIT_PIXELS", 0)
+	LIMIT_NICE                = EnvNumber("ENCODER_LIMIT_NICE", 0)
+	LIMIT_THREADS             = EnvNumber("ENCODER_LIMIT_THREADS", 0)
 )
 
 var (
-	encoderLostQueue = make(chan string, 100)
-	encoderCond      = sync.NewCond(&sync.Mutex{})
 	encoderStart     sync.Once
+	encoderJobs      = map[string]context.CancelFunc{} // Video ID => Cancel Encoding
+	encoderJobsMutex sync.Mutex
+	hlsHeights       []int
 )
 
-// Wake up a sleeping encoder to start working
-func WakeEncoder() {
-	encoderCond.L.Lock()
-	encoderCond.Signal()
-	encoderCond.L.Unlock()
+// Cancel the encoding of a video if a worker is currently processing it
+func CancelEncoder(videoID string) bool {
+	encoderJobsMutex.Lock()
+	defer encoderJobsMutex.Unlock()
+	if cancel, ok := encoderJobs[videoID]; ok {
+		cancel()
+		return true
+	}
+	return false
+}
+
+// IDs of the Videos currently being Encoded
+func EncoderActive() map[string]bool {
+	encoderJobsMutex.Lock()
+	defer encoderJobsMutex.Unlock()
+	active := make(map[string]bool, len(encoderJobs))
+	for videoID := range encoderJobs {
+		active[videoID] = true
+	}
+	return active
+}
+
+// Detect the Video Codec and Prepare the Working Directory
+// - Used by both the server and remote workers, which each have their own working directory
+func setupEncoder(workDirectory string) {
+	// Attempt to encode a black frame using an encoder from the list
+	// If succesful use that instead
+	if ENCODER_USE_HARDWARE {
+		for _, someCodec := range strings.Split(VIDEO_HARDWARE_CODEC, ",") {
+			if err := exec.Command(
+				"ffmpeg", "-an", "-sn",
+				"-f", "lavfi",
+				"-i", "color=black:s=1080x1080",
+				"-vframes", "1",
+				"-c:v", someCodec,
+				"-f", "null",
+				"-",
+			).Run(); err == nil {
+				VIDEO_CODEC = someCodec
+				break
+			}
+		}
+	}
+	// Clear out Work from the Previous Run
+	// Anything left behind was interrupted and is queued again by the server
+	os.RemoveAll(workDirectory)
+	if err := os.MkdirAll(workDirectory, FILE_MODE); err != nil {
+		log.Fatalln("[env/encoder]", err)
+	}
+	log.Println("[env/encoder] Using video codec:", VIDEO_CODEC)
+	log.Println("[env/encoder] Using audio codec:", AUDIO_CODEC)
+
+	// Parse Rendition Ladder for Adaptive Streaming
+	if HLS_ENABLED {
+		for _, s := range strings.Split(HLS_RENDITIONS, ",") {
+			h, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || h <= 0 {
+				log.Fatalln("[env/encoder] Invalid HLS Rendition:", s)
+			}
+			hlsHeights = append(hlsHeights, h)
+		}
+		slices.Sort(hlsHeights)
+		slices.Reverse(hlsHeights)
+		log.Println("[env/encoder] Using HLS renditions:", hlsHeights)
+	}
 }
 
 // Setup for Encoding
 func StartEncoders(stop context.Context, await *sync.WaitGroup) {
 	encoderStart.Do(func() {
+		setupEncoder(path.Join(DATA_DIR, "temp"))
 
-		// Attempt to encode a black frame using an encoder from the list
-		// If succesful use that instead
-		if ENCODER_USE_HARDWARE {
-			for _, someCodec := range strings.Split(VIDEO_HARDWARE_CODEC, ",") {
-				if err := exec.Command(
-					"ffmpeg", "-an", "-sn",
-					"-f", "lavfi",
-					"-i", "color=black:s=1080x1080",
-					"-vframes", "1",
-					"-c:v", someCodec,
-					"-f", "null",
-					"-",
-				).Run(); err == nil {
-					VIDEO_CODEC = someCodec
-					break
-				}
-			}
+		// Queue Interrupted Videos Again
+		// These are videos that were being still being processed by the server when it shutdown,
+		// remote workers keep their leases and are left to startLeaseExpiry unless they were disabled
+		if _, err := DB.Exec(
+			"UPDATE encode_jobs SET status = 'CANCEL', finished = CURRENT_TIMESTAMP WHERE status = 'PROCESS' AND (lease_expires IS NULL OR $1)",
+			WORKER_SECRET == "",
+		); err != nil {
+			log.Fatalln("[env/encoder]", err)
+		}
+		if _, err := DB.Exec(
+			"UPDATE videos SET status = 'QUEUE' WHERE status = 'PROCESS' AND id NOT IN (SELECT video_id FROM encode_jobs WHERE status = 'PROCESS')",
+		); err != nil {
+			log.Fatalln("[env/encoder]", err)
 		}
-		log.Println("[env/encoder] Using video codec:", VIDEO_CODEC)
-		log.Println("[env/encoder] Using audio codec:", AUDIO_CODEC)
 
-		// Fill Lost Video Queue
-		// These are videos that were being still being processed by the server when it shutdown
-		rows, err := DB.Query("SELECT id from videos WHERE status = 'PROCESS'")
+		// Wake Encoders once Videos waiting to be Retried are due
+		rows, err := DB.Query(
+			`SELECT (julianday(retry_after) - julianday('now')) * 86400 FROM videos
+			WHERE status = 'QUEUE' AND retry_after > CURRENT_TIMESTAMP`,
+		)
 		if err != nil {
 			log.Fatalln("[env/encoder]", err)
 		}
 		for rows.Next() {
-			var videoID string
-			if err := rows.Scan(&videoID); err != nil {
+			var seconds float64
+			if err := rows.Scan(&seconds); err != nil {
 				log.Fatalln("[env/encoder]", err)
 			}
-			select {
-			case encoderLostQueue <- videoID:
-			default:
-				// This should NEVER happen, unless you have like over a hundred
-				// encoders (on one machine too btw) but at that point ???
-				log.Fatalln("[env/encoder] Lost queue is full, resizing...")
-				newQueue := make(chan string, cap(encoderLostQueue)+100)
-				drainLen := len(encoderLostQueue)
-				for i := 0; i < drainLen; i++ {
-					newQueue <- <-encoderLostQueue
-				}
-				encoderLostQueue = newQueue
-				encoderLostQueue <- videoID
-			}
+			time.AfterFunc(time.Duration(seconds+1)*time.Second, WakeEncoder)
 		}
+		rows.Close()
 
 		// Startup Encoders
+		var workers sync.WaitGroup
 		for i := 0; i < ENCODER_WORKERS; i++ {
-			go startEncoder(i)
+			workers.Add(1)
+			go func(workerId int) {
+				defer workers.Done()
+				startEncoder(stop, workerId)
+			}(i)
+		}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			startQueueNotifier(stop)
+		}()
+		if WORKER_SECRET != "" {
+			log.Printf("[env/encoder] Accepting remote workers, leases last %d seconds\n", WORKER_LEASE)
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				startLeaseExpiry(stop)
+			}()
 		}
+		notifyQueue()
 
 		// Shutdown Logic
+		// Workers need the database to queue their interrupted videos again
+		databaseUsers.Add(1)
 		await.Add(1)
 		go func() {
 			defer await.Done()
+			defer databaseUsers.Done()
 			<-stop.Done()
+			workers.Wait()
 			log.Println("[env/encoder] Closed Encoders")
 		}()
 
 	})
 }
 
-// Startup an Encoder
-func startEncoder(workerId int) {
-	for {
+// Startup an Encoder, returning once stop is cancelled and the current video was interrupted
+func startEncoder(stop context.Context, workerId int) {
+	for stop.Err() == nil {
 
 		// Step 0. Look for work
-		var videoID, videoCreated, userID string
-	searchLoop:
-		for {
+		videoID, videoCreated, userID, profile, trim, audio, err := claimVideo()
+		if err == sql.ErrNoRows {
+			log.Printf("[encoders][%d] Sleeping...\n", workerId)
 			select {
-
-			// Fetch an Item from the Lost Video Backlog
-			case videoId := <-encoderLostQueue:
-				err := DB.
-					QueryRow("SELECT id, created, user_id FROM videos WHERE id = $1", videoId).
-					Scan(&videoID, &videoCreated, &userID)
-				if err == sql.ErrNoRows {
-					continue
-				}
-				if err != nil {
-					log.Printf("[encoders][%d] %s\n", workerId, err)
-					time.Sleep(time.Second)
-					continue
-				}
-				break searchLoop
-
-			// Search the Database for a Queued Video
-			default:
-				err := DB.
-					QueryRow("SELECT id, created, user_id FROM videos WHERE status = 'QUEUE'").
-					Scan(&videoID, &videoCreated, &userID)
-				if err == sql.ErrNoRows {
-					log.Printf("[encoders][%d] Sleeping...\n", workerId)
-					encoderCond.L.Lock()
-					encoderCond.Wait()
-					encoderCond.L.Unlock()
-					continue
-				}
-				if err != nil {
-					log.Printf("[encoders][%d] %s\n", workerId, err)
-					time.Sleep(time.Second)
-					continue
-				}
-				break searchLoop
+			case <-encoderWake:
+			case <-stop.Done():
 			}
+			continue
 		}
+		if err != nil {
+			log.Printf("[encoders][%d] %s\n", workerId, err)
+			select {
+			case <-time.After(time.Second):
+			case <-stop.Done():
+			}
+			continue
+		}
+		notifyQueue()
+		processVideo(stop, workerId, videoID, videoCreated, userID, lookupProfile(profile), trim, audio)
+		notifyQueue()
+	}
+}
 
-		// Step 1. Preparations
-		var (
-			inputFilepath        = path.Join(DATA_DIR, "video", videoID)
-			outputDirectory      = path.Join(DATA_DIR, "public", videoID)
-			errorMessage         string
-			errorOutput          string
-			encodeVideoHeight    int
-			encodeVideoFramerate int
-			encodeAudioStreams   int
-			encodeVideoStreams   int
-		)
-		defer func() {
-			if errorMessage != "" {
-				log.Printf(
-					"[encoders][%d] Encoding Error (ID: %s): %s\nOutput: %s\n---\n",
-					workerId, videoID, errorMessage, errorOutput,
-				)
-				SendEvent(userID, "VIDEO_PROCESSING_ERROR", videoID, errorMessage)
-				DB.Exec("UPDATE videos SET status = 'ERROR' WHERE id = $1", videoID)
-				os.RemoveAll(outputDirectory)
+// Encode a Video and Generate its Thumbnail
+// - Cancelling stop interrupts the video and queues it again
+func processVideo(
+	stop context.Context,
+	workerId int,
+	videoID, videoCreated, userID string,
+	profile EncodeProfile,
+	trim VideoTrim,
+	audio VideoAudio,
+) {
+
+	// Step 1. Preparations
+	var (
+		inputFilepath   string
+		inputCleanup    = func() {}
+		outputDirectory = path.Join(DATA_DIR, "temp", videoID)
+		errorMessage    string
+		errorOutput     string
+		errorTransient  bool // Could retrying fix this error?
+		revision        = newRevision()
+		stored          bool // Have outputs been written to storage?
+		completed       bool // Was the video marked as finished?
+	)
+	ctx, cancel := context.WithCancel(stop)
+	encoderJobsMutex.Lock()
+	encoderJobs[videoID] = cancel
+	encoderJobsMutex.Unlock()
+	defer func() {
+		encoderJobsMutex.Lock()
+		delete(encoderJobs, videoID)
+		encoderJobsMutex.Unlock()
+		cancel()
+	}()
+	defer func() {
+		if ctx.Err() != nil && !completed && stop.Err() != nil {
+			// Server is shutting down, the video is encoded from scratch on the next startup
+			log.Printf("[encoders][%d] Encoding Interrupted (ID: %s)\n", workerId, videoID)
+			os.RemoveAll(outputDirectory)
+			if stored {
+				Storage.Delete(OutputsKey(videoID, revision))
+			}
+			if err := requeueVideo(videoID); err != nil {
+				log.Printf("[encoders][%d] Cannot Queue Interrupted Video (ID: %s): %s\n", workerId, videoID, err)
 			}
-		}()
-		if err := os.MkdirAll(outputDirectory, FILE_MODE); err != nil {
-			errorMessage = "Cannot Create Output Directory"
-			errorOutput = err.Error()
 			return
 		}
-		if _, err := DB.Exec("UPDATE videos SET status = 'PROCESS' WHERE id = $1", videoID); err != nil {
-			errorMessage = "Cannot Mark Video as Processing"
-			errorOutput = err.Error()
+		if ctx.Err() != nil && !completed {
+			// Video was deleted while it was being processed
+			log.Printf("[encoders][%d] Encoding Cancelled (ID: %s)\n", workerId, videoID)
+			os.RemoveAll(outputDirectory)
+			Storage.Delete("public/" + videoID)
 			return
 		}
-		SendEvent(userID, "VIDEO_PROCESSING_BEGIN", videoID, "")
-
-		// Step 2. Probe Video File
-		var Probe struct {
-			Streams []struct {
-				Index            int       `json:"index"`
-				CodecName        string    `json:"codec_name"`
-				Profile          string    `json:"profile"`
-				CodecType        string    `json:"codec_type"`
-				Width            int       `json:"width"`
-				Height           int       `json:"height"`
-				SampleRate       string    `json:"sample_rate"`
-				Channels         int       `json:"channels"`
-				ChannelLayout    string    `json:"channel_layout"`
-				AverageFrameRate framerate `json:"avg_frame_rate"`
-				TimeBase         string    `json:"time_base"`
-				Duration         string    `json:"duration"`
-				BitRate          string    `json:"bit_rate"`
-			} `json:"streams"`
-			Format struct {
-				Filename        string            `json:"filename"`
-				NumberOfStreams integer           `json:"nb_streams"`
-				Duration        float             `json:"duration"`
-				Size            integer           `json:"size"`
-				Bitrate         integer           `json:"bit_rate"`
-				Tags            map[string]string `json:"tags"`
-			} `json:"format"`
-		}
-		{
-			proc := exec.Command(
-				"ffprobe",
-				"-v", "error",
-				"-i", inputFilepath,
-				"-print_format", "json",
-				"-show_format",
-				"-show_streams",
+		if errorMessage != "" {
+			log.Printf(
+				"[encoders][%d] Encoding Error (ID: %s): %s\nOutput: %s\n---\n",
+				workerId, videoID, errorMessage, errorOutput,
 			)
-			output := bytes.Buffer{}
-			proc.Stderr = &output
-			proc.Stdout = &output
-			if err := proc.Run(); err != nil {
-				errorMessage = "Probe Error"
-				errorOutput = output.String()
-				return
+			os.RemoveAll(outputDirectory)
+			if stored {
+				Storage.Delete(OutputsKey(videoID, revision))
 			}
-
-			// Parse JSON Output
-			if err := json.Unmarshal(output.Bytes(), &Probe); err != nil {
-				errorMessage = "Invalid or Malformed Probe Output"
-				errorOutput = err.Error()
-				return
+			if delay, ok := failVideo(videoID, userID, errorMessage, errorTransient); ok {
+				log.Printf("[encoders][%d] Retrying in %s (ID: %s)\n", workerId, delay, videoID)
 			}
-
-			// Sanity Checks
-			for _, s := range Probe.Streams {
-				switch s.CodecType {
-				case "video":
-					encodeVideoStreams++
-					encodeVideoFramerate = min(int(s.AverageFrameRate), VIDEO_FPS_LIMIT)
-					encodeVideoHeight = min(s.Height, VIDEO_HEIGHT_LIMIT)
-				case "audio":
-					if encodeAudioStreams < AUDIO_STREAMS_LIMIT {
-						encodeAudioStreams++
-					}
-				}
+		}
+	}()
+	defer func() { inputCleanup() }()
+	if err := os.MkdirAll(outputDirectory, FILE_MODE); err != nil {
+		errorMessage = "Cannot Create Output Directory"
+		errorOutput = err.Error()
+		errorTransient = true
+		return
+	}
+	if jobID, err := startEncodeJob(videoID, workerId); err != nil {
+		log.Printf("[encoders][%d] Cannot Record Attempt (ID: %s): %s\n", workerId, videoID, err)
+	} else {
+		defer func() {
+			status, message, output := "FINISH", errorMessage, errorOutput
+			switch {
+			case ctx.Err() != nil && !completed:
+				// Errors are only from FFmpeg being killed
+				status, message, output = "CANCEL", "", ""
+			case errorMessage != "":
+				status = "ERROR"
 			}
-			if encodeVideoStreams == 0 {
-				errorMessage = "No Video Streams Present"
-				errorOutput = "N/A"
-				return
+			if err := finishEncodeJob(jobID, status, message, output); err != nil {
+				log.Printf("[encoders][%d] Cannot Record Attempt (ID: %s): %s\n", workerId, videoID, err)
 			}
+		}()
+	}
+	SendEvent(userID, "VIDEO_PROCESSING_BEGIN", videoID, "")
+	if p, c, err := StorageFetch("video/" + videoID); err != nil {
+		errorMessage = "Cannot Read Original Video"
+		errorOutput = err.Error()
+		errorTransient = !errors.Is(err, fs.ErrNotExist)
+		return
+	} else {
+		inputFilepath, inputCleanup = p, c
+	}
+
+	// Step 2. Encode Video
+	duration, outputs, errorMessage, errorOutput := encodePipeline(ctx, profile, trim, audio, inputFilepath, outputDirectory, func(percent string) {
+		SendEvent(userID, "VIDEO_PROCESSING_PROGRESS", videoID, percent)
+	})
+	if duration > 0 {
+		if _, err := DB.Exec("UPDATE videos SET duration = $1 WHERE id = $2", duration, videoID); err != nil {
+			log.Printf("[encoders][%d] Cannot Store Duration (ID: %s): %s\n", workerId, videoID, err)
 		}
+	}
+	if errorMessage != "" {
+		return
+	}
 
-		// Step 3. Encode Video
-		{
-			proc := exec.Command(
-				"ffmpeg",
-				"-y",
-				"-v", "error",
-				"-progress", "pipe:1",
-				"-i", inputFilepath,
-				"-c:v", VIDEO_CODEC,
-				"-pix_fmt", VIDEO_PIXEL_FORMAT,
-				"-preset", VIDEO_PRESET,
-				"-qp", VIDEO_QUALITY,
-				"-vf", "scale=-1:"+strconv.Itoa(encodeVideoHeight),
-				"-r", strconv.Itoa(encodeVideoFramerate),
-				"-c:a", AUDIO_CODEC,
-				"-b:a", AUDIO_BITRATE,
-				"-ac", AUDIO_CHANNELS,
-				"-filter_complex", "amerge=inputs="+strconv.Itoa(encodeAudioStreams),
-				path.Join(outputDirectory, OUTPUT_FILENAME_VIDEO),
-			)
-			output := bytes.Buffer{}
-			proc.Stderr = &output
+	// Step 3. Store Outputs alongside the ones being served
+	stored = true
+	if err := StoragePutDir(OutputsKey(videoID, revision), outputDirectory); err != nil {
+		errorMessage = "Cannot Store Outputs"
+		errorOutput = err.Error()
+		errorTransient = true
+		return
+	}
 
-			// Stream Progress
-			p, _ := proc.StdoutPipe()
-			go func() {
-				for {
-					// Parse Progress
-					b := make([]byte, 256)
-					n, err := p.Read(b)
-					if err != nil {
-						return
-					}
-					m := map[string]string{}
-					for _, line := range strings.Split(string(b[:n]), "\n") {
-						s := strings.SplitN(line, "=", 2)
-						if len(s) == 2 {
-							m[s[0]] = strings.TrimSpace(s[1])
-						}
-					}
-					switch m["progress"] {
-					case "continue":
-						o, err := strconv.ParseFloat(m["out_time_us"], 64)
-						if err != nil {
-							return
-						}
-						// Convert to Milliseconds
-						duration := math.Floor(float64(Probe.Format.Duration) * 1000)
-						progress := o / 1000
-						// Format as Percentage
-						percentd := strconv.FormatFloat((progress/duration)*100, 'f', 0, 64)
-						SendEvent(userID, "VIDEO_PROCESSING_PROGRESS", videoID, percentd)
-					case "end":
-						return
-					}
-				}
-			}()
-			if err := proc.Run(); err != nil {
-				errorMessage = "Encoding Error"
-				errorOutput = output.String()
-				return
+	// Step 4. Mark Video as Finished, which switches to the new outputs
+	if err := completeVideo(videoID, userID, videoCreated, revision, outputs); err == sql.ErrNoRows {
+		// Deleted while we were encoding
+		cancel()
+		return
+	} else if err != nil {
+		errorMessage = "Database Error"
+		errorOutput = err.Error()
+		errorTransient = true
+		return
+	}
+	completed = true
+	log.Printf("[encoders][%d] Video Processed: %s\n", workerId, videoID)
+}
+
+// Optional Outputs that were Generated for a Video
+type VideoOutputs struct {
+	HLS        bool `json:"hls"`        // Was an Adaptive Stream Generated?
+	Storyboard bool `json:"storyboard"` // Was a Sprite Sheet Generated for Seek Previews?
+	Animated   bool `json:"animated"`   // Was an Animated Preview Generated for Embeds?
+}
+
+// Section of a Video to Keep in Seconds, an End of 0 keeps everything after the Start
+type VideoTrim struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Are the Timestamps usable? Whether they fit within the video is only known once it is probed
+func (t VideoTrim) Valid() bool {
+	return t.Start >= 0 && t.End >= 0 && !math.IsInf(t.Start, 0) && !math.IsInf(t.End, 0) && (t.End == 0 || t.End > t.Start)
+}
+
+// Length of the Trimmed Video, an End past the video is clamped to it
+func (t VideoTrim) Length(duration float64) float64 {
+	if t.End > 0 {
+		duration = min(duration, t.End)
+	}
+	return max(duration-t.Start, 0)
+}
+
+// Probe and Encode a Video with a Profile, then Generate its Previews into the Output Directory
+// - Shared by the server and remote workers, neither storage nor the database are used
+// - Progress is reported as a percentage of every step combined
+// - Returns the length of the trimmed video in seconds, or 0 if it could not be probed
+func encodePipeline(
+	ctx context.Context,
+	profile EncodeProfile,
+	trim VideoTrim,
+	audio VideoAudio,
+	inputFilepath, outputDirectory string,
+	progress func(percent string),
+) (duration float64, outputs VideoOutputs, errorMessage, errorOutput string) {
+	var (
+		encodeVideoAspect    = 16.0 / 9
+		encodeVideoHeight    int
+		encodeVideoFramerate int
+		encodeAudioStreams   int
+		encodeAudioTracks    []AudioTrack
+		encodeVideoStreams   int
+		encodeSteps          = 1.0
+	)
+	if HLS_ENABLED {
+		encodeSteps++
+	}
+	if ANIMATED_ENABLED {
+		encodeSteps++
+	}
+	if SPRITES_ENABLED {
+		encodeSteps++
+	}
+	sendProgress := func(step int, percent float64) {
+		progress(strconv.FormatFloat((float64(step)*100+percent)/encodeSteps, 'f', 0, 64))
+	}
+
+	// Step 1. Probe Video File
+	probeCtx, probeCancel := limitContext(ctx, 0)
+	defer probeCancel()
+	info, err := MediaProber.Probe(probeCtx, inputFilepath)
+	if err != nil {
+		errorMessage = "Probe Error"
+		errorOutput = err.Error()
+		if probeCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			errorMessage = "Probe Timed Out"
+			errorOutput = fmt.Sprintf("Exceeded the limit of %s", encodeLimit(0))
+		}
+		return
+	}
+
+	// Everything after this point works with the trimmed video
+	if info.Duration > 0 && trim != (VideoTrim{}) {
+		if trim.Start >= info.Duration {
+			errorMessage = "Trim Outside Video"
+			errorOutput = fmt.Sprintf("Start of %.3f seconds is past the end of the %.3f second video", trim.Start, info.Duration)
+			return
+		}
+		info.Duration = trim.Length(info.Duration)
+	}
+	duration = info.Duration
+
+	// Sanity Checks
+	var encodeVideoPixels int
+	for _, s := range info.Streams {
+		switch s.Type {
+		case "video":
+			encodeVideoStreams++
+			encodeVideoPixels = max(encodeVideoPixels, s.Width*s.Height)
+			if profile.FPSLimit > 0 {
+				encodeVideoFramerate = min(s.Framerate, profile.FPSLimit)
+			}
+			if s.Width > 0 && s.Height > 0 {
+				encodeVideoAspect = float64(s.Width) / float64(s.Height)
+			}
+			encodeVideoHeight = s.Height
+			if profile.HeightLimit > 0 {
+				encodeVideoHeight = min(encodeVideoHeight, profile.HeightLimit)
 			}
+		case "audio":
+			encodeAudioStreams++
 		}
+	}
+	if encodeVideoStreams == 0 {
+		errorMessage = "No Video Streams Present"
+		errorOutput = "N/A"
+		return
+	}
+	if encodeAudioTracks, err = audio.resolve(encodeAudioStreams); err != nil {
+		errorMessage = "Audio Track Missing"
+		errorOutput = err.Error()
+		return
+	}
+	if LIMIT_DURATION > 0 && info.Duration > float64(LIMIT_DURATION) {
+		errorMessage = "Video Too Long"
+		errorOutput = fmt.Sprintf("Duration of %.0f seconds exceeds the limit of %d seconds", info.Duration, LIMIT_DURATION)
+		return
+	}
+	if LIMIT_PIXELS > 0 && encodeVideoPixels > LIMIT_PIXELS {
+		errorMessage = "Video Resolution Too High"
+		errorOutput = fmt.Sprintf("Resolution of %d pixels exceeds the limit of %d pixels", encodeVideoPixels, LIMIT_PIXELS)
+		return
+	}
 
-		// Step 4. Generate Thumbnail
-		{
-			proc := exec.Command(
-				"ffmpeg",
-				"-y",
-				"-v", "error",
-				"-i", inputFilepath,
-				"-vf", "scale=-1:"+strconv.Itoa(encodeVideoHeight),
-				"-frames:v", "1",
-				path.Join(outputDirectory, OUTPUT_FILENAME_THUMBNAIL),
+	// Time Limit for the Remaining Steps
+	encodeCtx, encodeCancel := limitContext(ctx, info.Duration)
+	defer encodeCancel()
+	defer func() {
+		if errorMessage != "" && encodeCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			errorMessage = "Encoding Timed Out"
+			errorOutput = fmt.Sprintf(
+				"Exceeded the limit of %s for a %.0f second video\n%s",
+				encodeLimit(info.Duration), info.Duration, errorOutput,
 			)
-			if b, err := proc.CombinedOutput(); err != nil {
-				errorMessage = "Thumbnail Error"
-				errorOutput = string(bytes.TrimSpace(b))
-				return
-			}
 		}
+	}()
+
+	// Step 2. Encode Video
+	err = MediaTranscoder.Encode(encodeCtx, TranscodeJob{
+		Input:         inputFilepath,
+		Output:        path.Join(outputDirectory, OUTPUT_FILENAME_VIDEO),
+		Profile:       profile,
+		Height:        encodeVideoHeight,
+		Framerate:     encodeVideoFramerate,
+		Audio:         encodeAudioTracks,
+		AudioSeparate: audio.Separate,
+		Start:         trim.Start,
+		End:           trim.End,
+		Duration:      info.Duration,
+	}, func(percent float64) {
+		sendProgress(0, percent)
+	})
+	if err != nil {
+		errorMessage = "Encoding Error"
+		errorOutput = err.Error()
+		return
+	}
+
+	// Step 3. Generate Adaptive Stream
+	// Re-uses the encoded video as the source so audio doesn't have to be merged again
+	if HLS_ENABLED {
+		err := MediaTranscoder.Stream(encodeCtx, StreamJob{
+			Input:      path.Join(outputDirectory, OUTPUT_FILENAME_VIDEO),
+			Directory:  outputDirectory,
+			Profile:    profile,
+			Renditions: hlsLadder(encodeVideoHeight),
+			Audio:      len(encodeAudioTracks) > 0,
+			Duration:   info.Duration,
+		}, func(percent float64) {
+			sendProgress(1, percent)
+		})
+		if err != nil {
+			errorMessage = "Adaptive Stream Error"
+			errorOutput = err.Error()
+			return
+		}
+	}
+
+	outputs.HLS = HLS_ENABLED
+
+	// Step 4. Generate Thumbnail
+	// Taken from a little way in as recordings often start on a black frame
+	err = MediaThumbnailer.Thumbnail(encodeCtx, ThumbnailJob{
+		Input:    inputFilepath,
+		Output:   path.Join(outputDirectory, OUTPUT_FILENAME_THUMBNAIL),
+		Height:   encodeVideoHeight,
+		Position: trim.Start + info.Duration*float64(THUMBNAIL_POSITION)/100,
+	})
+	if err != nil {
+		errorMessage = "Thumbnail Error"
+		errorOutput = err.Error()
+		return
+	}
 
-		// Step 5. Mark Video as Finished
-		if _, err := DB.Exec("UPDATE videos SET status = 'FINISH' WHERE id = $1", videoID); err != nil {
-			errorMessage = "Database Error"
+	// Step 5. Generate Animated Preview
+	// A short loop from the encoded video, kept within the video if it is near the end or shorter than the loop
+	if ANIMATED_ENABLED && info.Duration > 0 {
+		length := min(float64(ANIMATED_DURATION), info.Duration)
+		err := MediaThumbnailer.Animate(encodeCtx, AnimationJob{
+			Input:     path.Join(outputDirectory, OUTPUT_FILENAME_VIDEO),
+			Output:    path.Join(outputDirectory, OUTPUT_FILENAME_ANIMATED),
+			Start:     min(info.Duration*float64(ANIMATED_OFFSET)/100, info.Duration-length),
+			Duration:  length,
+			Height:    min(ANIMATED_HEIGHT, encodeVideoHeight),
+			Framerate: ANIMATED_FPS,
+		})
+		if err != nil {
+			errorMessage = "Animated Preview Error"
 			errorOutput = err.Error()
 			return
 		}
-		SendEvent(userID, "VIDEO_PROCESSING_COMPLETE", videoID, videoCreated)
-		log.Printf("[encoders][%d] Video Processed: %s\n", workerId, videoID)
+		outputs.Animated = true
+
+		// The preview is short so progress is only sent once it is finished
+		animatedStep := int(encodeSteps) - 1
+		if SPRITES_ENABLED {
+			animatedStep--
+		}
+		sendProgress(animatedStep, 100)
 	}
+
+	// Step 6. Generate Storyboard
+	// Evenly spaced frames are tiled into a single image, with a WebVTT file pointing to each frame for seek previews
+	if SPRITES_ENABLED && info.Duration > 0 {
+		interval := max(float64(SPRITES_INTERVAL), info.Duration/float64(SPRITES_LIMIT))
+		count := int(math.Ceil(info.Duration / interval))
+		job := SpriteJob{
+			Input:    path.Join(outputDirectory, OUTPUT_FILENAME_VIDEO),
+			Output:   path.Join(outputDirectory, OUTPUT_FILENAME_SPRITES),
+			Interval: interval,
+			Columns:  min(count, 10),
+			Width:    max(int(math.Round(float64(SPRITES_HEIGHT)*encodeVideoAspect/2))*2, 2), // Kept even for the encoder
+			Height:   SPRITES_HEIGHT,
+			Duration: info.Duration,
+		}
+		job.Rows = (count + job.Columns - 1) / job.Columns
+		err := MediaThumbnailer.Sprites(encodeCtx, job, func(percent float64) {
+			sendProgress(int(encodeSteps)-1, percent)
+		})
+		if err == nil {
+			err = writeStoryboard(path.Join(outputDirectory, OUTPUT_FILENAME_VTT), job, count)
+		}
+		if err != nil {
+			errorMessage = "Storyboard Error"
+			errorOutput = err.Error()
+			return
+		}
+		outputs.Storyboard = true
+	}
+	return
+}
+
+// Write a WebVTT File pointing each part of a Video to its Frame in the Sprite Sheet
+func writeStoryboard(filepath string, job SpriteJob, count int) error {
+	b := strings.Builder{}
+	b.WriteString("WEBVTT\n")
+	for i := range count {
+		start := float64(i) * job.Interval
+		fmt.Fprintf(
+			&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(min(start+job.Interval, job.Duration)), path.Base(job.Output),
+			i%job.Columns*job.Width, i/job.Columns*job.Height, job.Width, job.Height,
+		)
+	}
+	return os.WriteFile(filepath, []byte(b.String()), FILE_MODE)
 }
 
-// Some custom types since some values are wrapped in quotes and it trips up the json unmarshaller
+// Format Seconds as a WebVTT Timestamp (e.g. 83.5 => 00:01:23.500)
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
 
-// Parses the 1/60000 or whatever as a rounded integer
-type framerate int
+// Generate a Revision to Store a new set of Outputs under
+func newRevision() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
 
-func (f *framerate) UnmarshalJSON(b []byte) error {
-	s := strings.SplitN(strings.Trim(string(b), "\""), "/", 2)
-	if len(s) != 2 {
-		return errors.New("incorrect amount of segments")
+// Storage Key for a Revision of a Video's Outputs
+// - Each encode stores its outputs under a new revision so the previous ones are served until it finishes
+// - Videos encoded before revisions existed have their outputs directly under "public/<id>"
+func OutputsKey(videoID, revision string) string {
+	if revision == "" {
+		return "public/" + videoID
 	}
-	x, err := strconv.ParseFloat(s[0], 32)
+	return "public/" + videoID + "/" + revision
+}
+
+// Delete every Revision of a Video's Outputs except the one being served
+func pruneOutputs(videoID, keep string) error {
+	keys, err := Storage.List("public/" + videoID + "/")
 	if err != nil {
 		return err
 	}
-	y, err := strconv.ParseFloat(s[1], 32)
-	if err != nil {
-		return err
+	pruned := map[string]bool{}
+	for _, key := range keys {
+		revision, _, nested := strings.Cut(strings.TrimPrefix(key, "public/"+videoID+"/"), "/")
+		switch {
+		case !nested:
+			// Outputs from before revisions existed
+			err = Storage.Delete(key)
+		case revision != keep && !pruned[revision]:
+			pruned[revision] = true
+			err = Storage.Delete(OutputsKey(videoID, revision))
+		}
+		if err != nil {
+			return err
+		}
 	}
-	*f = framerate(math.Round(x / y))
 	return nil
 }
 
-// Parses a number string as an integer (e.g. "123" => 123)
-type integer int
-
-func (f *integer) UnmarshalJSON(b []byte) error {
-	v, err := strconv.Atoi(strings.Trim(string(b), "\""))
+// Mark a Video as Finished, switch it to the given Revision of Outputs and let its Owner know
+// - Returns sql.ErrNoRows if the video was deleted
+func completeVideo(videoID, userID, videoCreated, revision string, outputs VideoOutputs) error {
+	r, err := DB.Exec(
+		`UPDATE videos SET status = 'FINISH', published = 1, revision = $1, hls = $2, storyboard = $3, animated = $4,
+			attempts = 0, retry_after = NULL
+		WHERE id = $5`,
+		revision, outputs.HLS, outputs.Storyboard, outputs.Animated, videoID,
+	)
 	if err != nil {
 		return err
 	}
-	*f = integer(v)
+	if n, _ := r.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := pruneOutputs(videoID, revision); err != nil {
+		log.Printf("[env/encoder] Cannot Remove Previous Outputs (ID: %s): %s\n", videoID, err)
+	}
+	SendEvent(userID, "VIDEO_PROCESSING_COMPLETE", videoID, videoCreated)
 	return nil
 }
 
-// Parses a float string as a float64 (e.g. "123.123" => 123.123)
-type float float64
+// Mark a Video as Failed, unless retrying could fix the error and it has attempts left
+// - Videos that failed to re-encode keep serving their previous outputs
+// - Returns the delay before the video is retried, or false if it failed
+func failVideo(videoID, userID, errorMessage string, transient bool) (time.Duration, bool) {
+	if transient {
+		if delay, ok := retryVideo(videoID); ok {
+			SendEvent(userID, "VIDEO_PROCESSING_RETRY", videoID, errorMessage)
+			return delay, true
+		}
+	}
+	SendEvent(userID, "VIDEO_PROCESSING_ERROR", videoID, errorMessage)
+	var published bool
+	DB.QueryRow("UPDATE videos SET status = 'ERROR' WHERE id = $1 RETURNING published", videoID).Scan(&published)
+	if !published {
+		Storage.Delete("public/" + videoID)
+	}
+	return 0, false
+}
 
-func (f *float) UnmarshalJSON(b []byte) error {
-	v, err := strconv.ParseFloat(strings.Trim(string(b), "\""), 64)
+// Queue an Interrupted Video again, without counting it as an attempt
+func requeueVideo(videoID string) error {
+	var userID string
+	err := DB.
+		QueryRow("UPDATE videos SET status = 'QUEUE' WHERE id = $1 AND status = 'PROCESS' RETURNING user_id", videoID).
+		Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	*f = float(v)
+	SendEvent(userID, "VIDEO_QUEUED", videoID, "")
+	WakeEncoder()
 	return nil
 }
+
+// Queue a Video again after a Transient Error, waiting longer after each attempt
+// - Returns false once the video has run out of attempts
+func retryVideo(videoID string) (time.Duration, bool) {
+	var attempts int
+	err := DB.
+		QueryRow(
+			`UPDATE videos SET
+				status = 'QUEUE',
+				attempts = attempts + 1,
+				retry_after = datetime('now', '+' || ($1 << attempts) || ' seconds')
+			WHERE id = $2 AND attempts < $3
+			RETURNING attempts`,
+			RETRY_DELAY, videoID, RETRY_LIMIT,
+		).
+		Scan(&attempts)
+	if err != nil {
+		return 0, false
+	}
+	delay := time.Duration(RETRY_DELAY<<(attempts-1)) * time.Second
+	time.AfterFunc(delay+time.Second, WakeEncoder)
+	return delay, true
+}
+
+// How long FFmpeg can run for a video of the given duration (in seconds), longer videos are given more time
+// - The duration is whatever the container claims, so the time given is capped
+func encodeLimit(duration float64) time.Duration {
+	limit := float64(LIMIT_TIMEOUT) + float64(LIMIT_TIMEOUT_RATIO)*duration
+	if LIMIT_TIMEOUT_MAX > 0 {
+		limit = min(limit, float64(LIMIT_TIMEOUT_MAX))
+	}
+	return time.Duration(limit) * time.Second
+}
+
+// Limit how long FFmpeg can run for a video of the given duration, without a limit if none was configured
+func limitContext(parent context.Context, duration float64) (context.Context, context.CancelFunc) {
+	if limit := encodeLimit(duration); limit > 0 {
+		return context.WithTimeout(parent, limit)
+	}
+	return context.WithCancel(parent)
+}
+
+// Select Rendition Heights for a Video, the tallest rendition is capped to the given height
+func hlsLadder(maxHeight int) []int {
+	heights := []int{}
+	for _, h := range hlsHeights {
+		switch {
+		case h < maxHeight:
+			heights = append(heights, h)
+		case len(heights) == 0:
+			heights = append(heights, maxHeight)
+		}
+	}
+	return heights
+}
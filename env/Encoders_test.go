@@ -0,0 +1,747 @@
+package env
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Work from a Temporary Data Directory using Disk Storage
+	dir, err := os.MkdirTemp("", "shareclip-test-*")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	DATA_DIR, STORAGE_BACKEND = dir, "disk"
+	SetupData()
+	if err := SetupProfiles(); err != nil {
+		log.Fatalln(err)
+	}
+	stop, cancel := context.WithCancel(context.Background())
+	await := sync.WaitGroup{}
+	StartDatabase(stop, &await)
+
+	code := m.Run()
+	cancel()
+	await.Wait()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+var testCounter atomic.Int64
+
+// Queue a Video owned by a new User with a Placeholder Original in Storage
+func queueTestVideo(t *testing.T, profile string) (videoID, userID string) {
+	t.Helper()
+	n := testCounter.Add(1)
+	videoID, userID = fmt.Sprintf("testVideo%02d", n), fmt.Sprintf("testUser%02d", n)
+	if _, err := DB.Exec("INSERT INTO users (id, name) VALUES ($1, 'Tester')", userID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec(
+		"INSERT INTO videos (id, user_id, status, profile) VALUES ($1, $2, 'QUEUE', $3)",
+		videoID, userID, profile,
+	); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM videos WHERE id = $1", videoID)
+		Storage.Delete("public/" + videoID)
+		Storage.Delete("pending/" + videoID)
+		Storage.Delete("video/" + videoID)
+	})
+	if err := Storage.Put("video/"+videoID, strings.NewReader("original"), 8); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// Claim the Next Video from the Queue, which must be the given one
+func claimTestVideo(t *testing.T, videoID string) (videoCreated, userID string, profile EncodeProfile, trim VideoTrim, audio VideoAudio) {
+	t.Helper()
+	claimedID, videoCreated, userID, profileName, trim, audio, err := claimVideo()
+	if err != nil {
+		t.Fatal("Cannot Claim Video:", err)
+	}
+	if claimedID != videoID {
+		t.Fatalf("Claimed %s, expected %s", claimedID, videoID)
+	}
+	if status, _ := videoState(t, videoID); status != "PROCESS" {
+		t.Fatalf("Claimed video has status %s, expected PROCESS", status)
+	}
+	return videoCreated, userID, lookupProfile(profileName), trim, audio
+}
+
+// Claim and Encode the Next Video from the Queue like an Encoder would
+func encodeTestVideo(t *testing.T, videoID string) {
+	t.Helper()
+	videoCreated, userID, profile, trim, audio := claimTestVideo(t, videoID)
+	processVideo(context.Background(), 0, videoID, videoCreated, userID, profile, trim, audio)
+}
+
+// Fetch the Status and Failed Attempts of a Video
+func videoState(t *testing.T, videoID string) (status string, attempts int) {
+	t.Helper()
+	err := DB.QueryRow("SELECT status, attempts FROM videos WHERE id = $1", videoID).Scan(&status, &attempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// Fetch the Status and Error of the Latest Encoding Attempt for a Video
+func jobState(t *testing.T, videoID string) (status, message string) {
+	t.Helper()
+	var m *string
+	err := DB.
+		QueryRow("SELECT status, error FROM encode_jobs WHERE video_id = $1 ORDER BY id DESC LIMIT 1", videoID).
+		Scan(&status, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m != nil {
+		message = *m
+	}
+	return
+}
+
+type testEvent struct {
+	Type    string `json:"t"`
+	Subject string `json:"s"`
+	Data    any    `json:"d"`
+}
+
+// Receive the Events sent to a User until the Test Finishes
+func listenEvents(t *testing.T, userID string) chan string {
+	ch := make(chan string, 100)
+	EventMutex.Lock()
+	if EventChannels[userID] == nil {
+		EventChannels[userID] = map[chan string]bool{}
+	}
+	EventChannels[userID][ch] = true
+	EventMutex.Unlock()
+	t.Cleanup(func() {
+		EventMutex.Lock()
+		delete(EventChannels[userID], ch)
+		EventMutex.Unlock()
+	})
+	return ch
+}
+
+// Events received so far, progress updates are left out
+func receivedEvents(t *testing.T, ch chan string) []testEvent {
+	t.Helper()
+	events := []testEvent{}
+	for {
+		select {
+		case s := <-ch:
+			var e testEvent
+			if err := json.Unmarshal([]byte(s), &e); err != nil {
+				t.Fatal(err)
+			}
+			if e.Type != "VIDEO_PROCESSING_PROGRESS" {
+				events = append(events, e)
+			}
+		default:
+			return events
+		}
+	}
+}
+
+// Check the Types of the Events received so far
+func expectEvents(t *testing.T, ch chan string, types ...string) []testEvent {
+	t.Helper()
+	events := receivedEvents(t, ch)
+	received := []string{}
+	for _, e := range events {
+		received = append(received, e.Type)
+	}
+	if !slices.Equal(received, types) {
+		t.Fatalf("Received events %v, expected %v", received, types)
+	}
+	return events
+}
+
+// Storage Key of an Output from the Revision a Video is Served from
+func outputKey(videoID, filename string) string {
+	var revision string
+	DB.QueryRow("SELECT revision FROM videos WHERE id = $1", videoID).Scan(&revision)
+	return OutputsKey(videoID, revision) + "/" + filename
+}
+
+// Check if a Video was Published to Storage
+func published(videoID string) bool {
+	_, err := Storage.Stat(outputKey(videoID, OUTPUT_FILENAME_VIDEO))
+	return err == nil
+}
+
+func TestEncodeFinish(t *testing.T) {
+	enabled := SPRITES_ENABLED
+	SPRITES_ENABLED = true
+	t.Cleanup(func() { SPRITES_ENABLED = enabled })
+	media := useFakeMedia(t, fakeRecording())
+	videoID, userID := queueTestVideo(t, "default")
+	events := listenEvents(t, userID)
+	encodeTestVideo(t, videoID)
+
+	if status, attempts := videoState(t, videoID); status != "FINISH" || attempts != 0 {
+		t.Errorf("Video has status %s with %d attempts, expected FINISH with 0", status, attempts)
+	}
+	if status, _ := jobState(t, videoID); status != "FINISH" {
+		t.Errorf("Job has status %s, expected FINISH", status)
+	}
+	var duration float64
+	DB.QueryRow("SELECT duration FROM videos WHERE id = $1", videoID).Scan(&duration)
+	if duration != 30 {
+		t.Errorf("Stored duration %f, expected 30", duration)
+	}
+	for _, filename := range []string{OUTPUT_FILENAME_VIDEO, OUTPUT_FILENAME_THUMBNAIL, OUTPUT_FILENAME_SPRITES, OUTPUT_FILENAME_VTT} {
+		if _, err := Storage.Stat(outputKey(videoID, filename)); err != nil {
+			t.Errorf("Missing output %s: %s", filename, err)
+		}
+	}
+	if len(media.transcodes) != 1 || len(media.thumbnails) != 1 {
+		t.Fatalf("Encoded %d times with %d thumbnails, expected 1 of each", len(media.transcodes), len(media.thumbnails))
+	}
+	if job := media.transcodes[0]; len(job.Audio) != 2 || job.Duration != 30 {
+		t.Errorf("Encoded %d audio tracks for %f seconds, expected 2 for 30", len(job.Audio), job.Duration)
+	}
+	if position := media.thumbnails[0].Position; position != 30*float64(THUMBNAIL_POSITION)/100 {
+		t.Errorf("Thumbnail taken from %f seconds in, expected %d%% of the way", position, THUMBNAIL_POSITION)
+	}
+	var storyboard bool
+	DB.QueryRow("SELECT storyboard FROM videos WHERE id = $1", videoID).Scan(&storyboard)
+	if len(media.sprites) != 1 || !storyboard {
+		t.Errorf("Generated %d sprite sheets with storyboard %t, expected 1 with true", len(media.sprites), storyboard)
+	}
+	expectEvents(t, events, "VIDEO_PROCESSING_BEGIN", "VIDEO_PROCESSING_COMPLETE")
+}
+
+func TestEncodeProgress(t *testing.T) {
+	sprites, animated := SPRITES_ENABLED, ANIMATED_ENABLED
+	t.Cleanup(func() { SPRITES_ENABLED, ANIMATED_ENABLED = sprites, animated })
+	tests := []struct {
+		name     string
+		animated bool
+		progress []any
+	}{
+		{"storyboard", false, []any{"25", "50", "100"}},
+		{"animated", true, []any{"17", "33", "67", "100"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SPRITES_ENABLED, ANIMATED_ENABLED = true, tt.animated
+			useFakeMedia(t, fakeRecording())
+			videoID, userID := queueTestVideo(t, "default")
+			events := listenEvents(t, userID)
+			encodeTestVideo(t, videoID)
+
+			progress := []any{}
+			for len(events) > 0 {
+				var e testEvent
+				json.Unmarshal([]byte(<-events), &e)
+				if e.Type == "VIDEO_PROCESSING_PROGRESS" {
+					progress = append(progress, e.Data)
+				}
+			}
+			if !slices.Equal(progress, tt.progress) {
+				t.Errorf("Received progress %v, expected %v", progress, tt.progress)
+			}
+		})
+	}
+}
+
+func TestStoryboard(t *testing.T) {
+	filepath := path.Join(t.TempDir(), "storyboard.vtt")
+	job := SpriteJob{Output: "/temp/sprites.jpg", Interval: 5, Columns: 2, Rows: 2, Width: 160, Height: 90, Duration: 12.5}
+	if err := writeStoryboard(filepath, job, 3); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "WEBVTT\n" +
+		"\n00:00:00.000 --> 00:00:05.000\nsprites.jpg#xywh=0,0,160,90\n" +
+		"\n00:00:05.000 --> 00:00:10.000\nsprites.jpg#xywh=160,0,160,90\n" +
+		"\n00:00:10.000 --> 00:00:12.500\nsprites.jpg#xywh=0,90,160,90\n"
+	if string(b) != expected {
+		t.Errorf("Wrote storyboard:\n%s\nexpected:\n%s", b, expected)
+	}
+}
+
+func TestAnimatedPreview(t *testing.T) {
+	enabled, offset := ANIMATED_ENABLED, ANIMATED_OFFSET
+	ANIMATED_ENABLED = true
+	t.Cleanup(func() { ANIMATED_ENABLED, ANIMATED_OFFSET = enabled, offset })
+	tests := []struct {
+		name     string
+		duration float64
+		offset   int
+		start    float64
+		length   float64
+	}{
+		{"offset", 30, 10, 3, float64(ANIMATED_DURATION)},
+		{"near-end", 30, 100, 30 - float64(ANIMATED_DURATION), float64(ANIMATED_DURATION)},
+		{"shorter", 2, 10, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ANIMATED_OFFSET = tt.offset
+			info := fakeRecording()
+			info.Duration = tt.duration
+			media := useFakeMedia(t, info)
+			videoID, _ := queueTestVideo(t, "default")
+			encodeTestVideo(t, videoID)
+
+			if _, err := Storage.Stat(outputKey(videoID, OUTPUT_FILENAME_ANIMATED)); err != nil {
+				t.Errorf("Missing output %s: %s", OUTPUT_FILENAME_ANIMATED, err)
+			}
+			var animated bool
+			DB.QueryRow("SELECT animated FROM videos WHERE id = $1", videoID).Scan(&animated)
+			if len(media.animations) != 1 || !animated {
+				t.Fatalf("Generated %d animations with animated %t, expected 1 with true", len(media.animations), animated)
+			}
+			if job := media.animations[0]; job.Start != tt.start || job.Duration != tt.length {
+				t.Errorf("Animated %f seconds from %f, expected %f from %f", job.Duration, job.Start, tt.length, tt.start)
+			}
+		})
+	}
+}
+
+func TestEncodeProfiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		profile   EncodeProfile
+		height    int
+		framerate int
+	}{
+		{"limited", EncodeProfile{HeightLimit: 720, FPSLimit: 30}, 720, 30},
+		{"above-source", EncodeProfile{HeightLimit: 1440, FPSLimit: 144}, 1080, 60},
+		{"source", EncodeProfile{}, 1080, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ENCODER_PROFILES["test-"+tt.name] = tt.profile
+			t.Cleanup(func() { delete(ENCODER_PROFILES, "test-"+tt.name) })
+			media := useFakeMedia(t, fakeRecording())
+			videoID, _ := queueTestVideo(t, "test-"+tt.name)
+			encodeTestVideo(t, videoID)
+
+			if len(media.transcodes) != 1 {
+				t.Fatalf("Encoded %d times, expected once", len(media.transcodes))
+			}
+			job := media.transcodes[0]
+			if job.Profile != tt.profile {
+				t.Errorf("Encoded with %+v, expected %+v", job.Profile, tt.profile)
+			}
+			if job.Height != tt.height || job.Framerate != tt.framerate {
+				t.Errorf("Encoded at %dp%d, expected %dp%d", job.Height, job.Framerate, tt.height, tt.framerate)
+			}
+			if media.thumbnails[0].Height != tt.height {
+				t.Errorf("Thumbnail at %dp, expected %dp", media.thumbnails[0].Height, tt.height)
+			}
+		})
+	}
+}
+
+func TestEncodeTrim(t *testing.T) {
+	limit := LIMIT_DURATION
+	LIMIT_DURATION = 20
+	t.Cleanup(func() { LIMIT_DURATION = limit })
+	tests := []struct {
+		name     string
+		trim     VideoTrim
+		duration float64
+		message  string
+	}{
+		{"section", VideoTrim{Start: 5, End: 15}, 10, ""},
+		{"until-end", VideoTrim{Start: 12}, 18, ""},
+		{"past-end", VideoTrim{Start: 20, End: 60}, 10, ""},
+		{"untrimmed", VideoTrim{}, 30, "Video Too Long"},
+		{"outside", VideoTrim{Start: 45}, 0, "Trim Outside Video"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			media := useFakeMedia(t, fakeRecording())
+			videoID, _ := queueTestVideo(t, "default")
+			if _, err := DB.Exec(
+				"UPDATE videos SET trim_start = $1, trim_end = $2 WHERE id = $3",
+				tt.trim.Start, tt.trim.End, videoID,
+			); err != nil {
+				t.Fatal(err)
+			}
+			encodeTestVideo(t, videoID)
+
+			if tt.message != "" {
+				if status, message := jobState(t, videoID); status != "ERROR" || message != tt.message {
+					t.Errorf("Job has status %s with '%s', expected ERROR with '%s'", status, message, tt.message)
+				}
+				return
+			}
+			if len(media.transcodes) != 1 || len(media.thumbnails) != 1 {
+				t.Fatalf("Encoded %d times with %d thumbnails, expected 1 of each", len(media.transcodes), len(media.thumbnails))
+			}
+			job := media.transcodes[0]
+			if job.Start != tt.trim.Start || job.End != tt.trim.End || job.Duration != tt.duration {
+				t.Errorf(
+					"Encoded %f to %f for %f seconds, expected %f to %f for %f",
+					job.Start, job.End, job.Duration, tt.trim.Start, tt.trim.End, tt.duration,
+				)
+			}
+			if position, expected := media.thumbnails[0].Position, tt.trim.Start+tt.duration*float64(THUMBNAIL_POSITION)/100; position != expected {
+				t.Errorf("Thumbnail taken from %f seconds in, expected %f", position, expected)
+			}
+			var duration float64
+			DB.QueryRow("SELECT duration FROM videos WHERE id = $1", videoID).Scan(&duration)
+			if duration != tt.duration {
+				t.Errorf("Stored duration %f, expected %f", duration, tt.duration)
+			}
+		})
+	}
+}
+
+func TestEncodeAudio(t *testing.T) {
+	enabled := HLS_ENABLED
+	HLS_ENABLED = true
+	t.Cleanup(func() { HLS_ENABLED = enabled })
+	both := []AudioTrack{{Track: 0, Volume: 1}, {Track: 1, Volume: 1}}
+	tests := []struct {
+		name    string
+		streams int
+		audio   VideoAudio
+		tracks  []AudioTrack
+		message string
+		stored  string // Audio as stored in the database, replaces audio when set
+	}{
+		{"silent", 0, VideoAudio{}, []AudioTrack{}, "", ""},
+		{"every-track", 2, VideoAudio{}, both, "", ""},
+		{"chosen", 2, VideoAudio{Tracks: []AudioTrack{{Track: 1, Volume: 0.5}}}, []AudioTrack{{Track: 1, Volume: 0.5}}, "", ""},
+		{"separate", 2, VideoAudio{Tracks: both, Separate: true}, both, "", ""},
+		{"missing", 1, VideoAudio{Tracks: both}, nil, "Audio Track Missing", ""},
+		{name: "default-volume", streams: 2, tracks: []AudioTrack{{Track: 1, Volume: 1}}, stored: `{"tracks": [{"track": 1}]}`},
+		{name: "muted", streams: 2, tracks: []AudioTrack{{Track: 1, Volume: 0}}, stored: `{"tracks": [{"track": 1, "volume": 0}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := fakeRecording()
+			info.Streams = info.Streams[:1+tt.streams]
+			media := useFakeMedia(t, info)
+			videoID, _ := queueTestVideo(t, "default")
+			var audio any = tt.audio
+			if tt.stored != "" {
+				audio = tt.stored
+			}
+			if _, err := DB.Exec("UPDATE videos SET audio = $1 WHERE id = $2", audio, videoID); err != nil {
+				t.Fatal(err)
+			}
+			encodeTestVideo(t, videoID)
+
+			if tt.message != "" {
+				if status, message := jobState(t, videoID); status != "ERROR" || message != tt.message {
+					t.Errorf("Job has status %s with '%s', expected ERROR with '%s'", status, message, tt.message)
+				}
+				return
+			}
+			if len(media.transcodes) != 1 || len(media.streams) != 1 {
+				t.Fatalf("Encoded %d times with %d streams, expected 1 of each", len(media.transcodes), len(media.streams))
+			}
+			job := media.transcodes[0]
+			if !slices.Equal(job.Audio, tt.tracks) || job.AudioSeparate != tt.audio.Separate {
+				t.Errorf("Encoded audio %v separate %t, expected %v separate %t", job.Audio, job.AudioSeparate, tt.tracks, tt.audio.Separate)
+			}
+			if audio := media.streams[0].Audio; audio != (len(tt.tracks) > 0) {
+				t.Errorf("Streamed with audio %t, expected %t", audio, len(tt.tracks) > 0)
+			}
+		})
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	failure := errors.New("something broke")
+	tests := []struct {
+		message string
+		setup   func(t *testing.T, media *fakeMedia)
+	}{
+		{"Probe Error", func(t *testing.T, media *fakeMedia) {
+			media.probeErr = failure
+		}},
+		{"No Video Streams Present", func(t *testing.T, media *fakeMedia) {
+			media.info.Streams = media.info.Streams[1:]
+		}},
+		{"Video Too Long", func(t *testing.T, media *fakeMedia) {
+			limit := LIMIT_DURATION
+			LIMIT_DURATION = 10
+			t.Cleanup(func() { LIMIT_DURATION = limit })
+		}},
+		{"Video Resolution Too High", func(t *testing.T, media *fakeMedia) {
+			limit := LIMIT_PIXELS
+			LIMIT_PIXELS = 1280 * 720
+			t.Cleanup(func() { LIMIT_PIXELS = limit })
+		}},
+		{"Encoding Error", func(t *testing.T, media *fakeMedia) {
+			media.encodeErr = failure
+		}},
+		{"Thumbnail Error", func(t *testing.T, media *fakeMedia) {
+			media.thumbErr = failure
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			media := useFakeMedia(t, fakeRecording())
+			tt.setup(t, media)
+			videoID, userID := queueTestVideo(t, "default")
+			events := listenEvents(t, userID)
+			encodeTestVideo(t, videoID)
+
+			if status, _ := videoState(t, videoID); status != "ERROR" {
+				t.Errorf("Video has status %s, expected ERROR", status)
+			}
+			if status, message := jobState(t, videoID); status != "ERROR" || message != tt.message {
+				t.Errorf("Job has status %s with '%s', expected ERROR with '%s'", status, message, tt.message)
+			}
+			if published(videoID) {
+				t.Error("Failed video was published")
+			}
+			received := expectEvents(t, events, "VIDEO_PROCESSING_BEGIN", "VIDEO_PROCESSING_ERROR")
+			if received[1].Data != tt.message {
+				t.Errorf("Error event has '%v', expected '%s'", received[1].Data, tt.message)
+			}
+		})
+	}
+}
+
+// Storage that Refuses to Store anything
+type failingStorage struct{ StorageBackend }
+
+func (failingStorage) Put(key string, r io.Reader, size int64) error {
+	return errors.New("storage unavailable")
+}
+
+func TestEncodeRetry(t *testing.T) {
+	useFakeMedia(t, fakeRecording())
+	videoID, userID := queueTestVideo(t, "default")
+	events := listenEvents(t, userID)
+	storage := Storage
+	Storage = failingStorage{storage}
+	t.Cleanup(func() { Storage = storage })
+	encodeTestVideo(t, videoID)
+
+	if status, attempts := videoState(t, videoID); status != "QUEUE" || attempts != 1 {
+		t.Errorf("Video has status %s with %d attempts, expected QUEUE with 1", status, attempts)
+	}
+	if status, message := jobState(t, videoID); status != "ERROR" || message != "Cannot Store Outputs" {
+		t.Errorf("Job has status %s with '%s', expected ERROR with 'Cannot Store Outputs'", status, message)
+	}
+	if _, _, _, _, _, _, err := claimVideo(); err != sql.ErrNoRows {
+		t.Errorf("Claimed a video waiting to be retried: %v", err)
+	}
+	expectEvents(t, events, "VIDEO_PROCESSING_BEGIN", "VIDEO_PROCESSING_RETRY")
+}
+
+func TestEncodeInterrupted(t *testing.T) {
+	media := useFakeMedia(t, fakeRecording())
+	media.hold = make(chan struct{})
+	media.started = make(chan struct{})
+	videoID, userID := queueTestVideo(t, "default")
+	events := listenEvents(t, userID)
+	videoCreated, _, profile, trim, audio := claimTestVideo(t, videoID)
+
+	stop, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		processVideo(stop, 0, videoID, videoCreated, userID, profile, trim, audio)
+		close(done)
+	}()
+	<-media.started
+	cancel()
+	<-done
+
+	if status, attempts := videoState(t, videoID); status != "QUEUE" || attempts != 0 {
+		t.Errorf("Video has status %s with %d attempts, expected QUEUE with 0", status, attempts)
+	}
+	if status, _ := jobState(t, videoID); status != "CANCEL" {
+		t.Errorf("Job has status %s, expected CANCEL", status)
+	}
+	expectEvents(t, events, "VIDEO_PROCESSING_BEGIN", "VIDEO_QUEUED")
+}
+
+func TestEncodeDeleted(t *testing.T) {
+	media := useFakeMedia(t, fakeRecording())
+	media.hold = make(chan struct{})
+	media.started = make(chan struct{})
+	videoID, userID := queueTestVideo(t, "default")
+	events := listenEvents(t, userID)
+	videoCreated, _, profile, trim, audio := claimTestVideo(t, videoID)
+
+	done := make(chan struct{})
+	go func() {
+		processVideo(context.Background(), 0, videoID, videoCreated, userID, profile, trim, audio)
+		close(done)
+	}()
+	<-media.started
+	if err := DeleteVideo(videoID); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	if _, err := Storage.Stat("public/" + videoID); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Deleted video left outputs behind: %v", err)
+	}
+	expectEvents(t, events, "VIDEO_PROCESSING_BEGIN", "VIDEO_DELETED")
+}
+
+// Check if a Video is Served, which it remains while being Re-encoded
+func servedVideo(t *testing.T, videoID string) bool {
+	t.Helper()
+	var served bool
+	if err := DB.QueryRow("SELECT published FROM videos WHERE id = $1", videoID).Scan(&served); err != nil {
+		t.Fatal(err)
+	}
+	return served
+}
+
+func TestReencodeFailure(t *testing.T) {
+	media := useFakeMedia(t, fakeRecording())
+	videoID, userID := queueTestVideo(t, "default")
+	encodeTestVideo(t, videoID)
+	if queued, err := ReencodeVideos(videoID, "", ""); err != nil || len(queued) != 1 {
+		t.Fatalf("Queued %v for re-encoding: %v", queued, err)
+	}
+	if !servedVideo(t, videoID) || !published(videoID) {
+		t.Error("Queued video stopped being served")
+	}
+
+	events := listenEvents(t, userID)
+	media.encodeErr = errors.New("something broke")
+	encodeTestVideo(t, videoID)
+	if status, _ := videoState(t, videoID); status != "ERROR" {
+		t.Errorf("Video has status %s, expected ERROR", status)
+	}
+	if !servedVideo(t, videoID) || !published(videoID) {
+		t.Error("Failed re-encode removed the previous outputs")
+	}
+	expectEvents(t, events, "VIDEO_PROCESSING_BEGIN", "VIDEO_PROCESSING_ERROR")
+}
+
+func TestReencodeLease(t *testing.T) {
+	useFakeMedia(t, fakeRecording())
+	videoID, _ := queueTestVideo(t, "default")
+	encodeTestVideo(t, videoID)
+	if _, err := ReencodeVideos(videoID, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	readOutput := func() string {
+		r, err := Storage.Get(outputKey(videoID, OUTPUT_FILENAME_VIDEO))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		b, _ := io.ReadAll(r)
+		return string(b)
+	}
+	previous := readOutput()
+
+	// Uploads are staged until the Lease Finishes
+	lease, err := LeaseVideo("tester", "h264")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Storage.Put("pending/"+videoID+"/"+OUTPUT_FILENAME_VIDEO, strings.NewReader("reencoded"), 9); err != nil {
+		t.Fatal(err)
+	}
+	if output := readOutput(); output != previous || !servedVideo(t, videoID) {
+		t.Errorf("Serving '%s' while re-encoding, expected the previous output", output)
+	}
+	if err := FinishLease(lease.JobID, WorkerResult{}); err != nil {
+		t.Fatal(err)
+	}
+	if output := readOutput(); output != "reencoded" || !servedVideo(t, videoID) {
+		t.Errorf("Serving '%s' after re-encoding, expected the new output", output)
+	}
+	if keys, _ := Storage.List("pending/" + videoID + "/"); len(keys) != 0 {
+		t.Errorf("Staged outputs were left behind: %v", keys)
+	}
+	keys, _ := Storage.List("public/" + videoID + "/")
+	for _, key := range keys {
+		if !strings.HasPrefix(key, outputKey(videoID, "")) {
+			t.Errorf("Previous output %s was left behind", key)
+		}
+	}
+}
+
+func TestEncoderWorker(t *testing.T) {
+	useFakeMedia(t, fakeRecording())
+	videoID, userID := queueTestVideo(t, "default")
+	events := listenEvents(t, userID)
+
+	stop, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		startEncoder(stop, 0)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	WakeEncoder()
+
+	// Wait for the Encoder to take the Video from the Queue and Finish it
+	received := []string{}
+	for !slices.Contains(received, "VIDEO_PROCESSING_COMPLETE") {
+		select {
+		case s := <-events:
+			var e testEvent
+			json.Unmarshal([]byte(s), &e)
+			if e.Type != "VIDEO_PROCESSING_PROGRESS" {
+				received = append(received, e.Type)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Received events %v after 5 seconds, expected the video to finish", received)
+		}
+	}
+	if !slices.Equal(received, []string{"VIDEO_PROCESSING_BEGIN", "VIDEO_PROCESSING_COMPLETE"}) {
+		t.Errorf("Received events %v, expected [VIDEO_PROCESSING_BEGIN VIDEO_PROCESSING_COMPLETE]", received)
+	}
+	if status, _ := videoState(t, videoID); status != "FINISH" {
+		t.Errorf("Video has status %s, expected FINISH", status)
+	}
+}
+
+func TestEncodeLimit(t *testing.T) {
+	timeout, ratio, capped := LIMIT_TIMEOUT, LIMIT_TIMEOUT_RATIO, LIMIT_TIMEOUT_MAX
+	t.Cleanup(func() { LIMIT_TIMEOUT, LIMIT_TIMEOUT_RATIO, LIMIT_TIMEOUT_MAX = timeout, ratio, capped })
+	tests := []struct {
+		name                   string
+		timeout, ratio, capped int
+		duration               float64
+		expected               time.Duration
+	}{
+		{"short", 300, 10, 21600, 30, 600 * time.Second},
+		{"claims-forever", 300, 10, 21600, 1e12, 21600 * time.Second},
+		{"uncapped", 300, 10, 0, 3600, 36300 * time.Second},
+		{"disabled", 0, 0, 21600, 1e12, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			LIMIT_TIMEOUT, LIMIT_TIMEOUT_RATIO, LIMIT_TIMEOUT_MAX = tt.timeout, tt.ratio, tt.capped
+			if limit := encodeLimit(tt.duration); limit != tt.expected {
+				t.Errorf("Limited to %s, expected %s", limit, tt.expected)
+			}
+		})
+	}
+}
@@ -8,10 +8,17 @@ import (
 )
 
 var (
-	EventChannels = map[string]chan string{}
+	EventChannels = map[string]map[chan string]bool{} // User ID => Connected Tabs
 	EventMutex    sync.RWMutex
+	EventsClosed  = make(chan struct{}) // Closed once the server is shutting down so connected tabs are let go
+	eventsClose   sync.Once
 )
 
+// End every Event Stream, they otherwise stay open until the tab is closed and would hold up shutdown
+func CloseEvents() {
+	eventsClose.Do(func() { close(EventsClosed) })
+}
+
 // Send a Event to the User via SSE (if connected)
 // - eventType: The Event Type capitilized and written using the snake case naming convention (e.g. MY_EVENT)
 // - eventSubject: The Relevant User or Video ID
@@ -31,7 +38,7 @@ func SendMessage(userID string, data any) error {
 		return err
 	}
 	EventMutex.RLock()
-	if ch, ok := EventChannels[userID]; ok {
+	for ch := range EventChannels[userID] {
 		select {
 		case ch <- string(b):
 		default:
@@ -0,0 +1,371 @@
+package env
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Media Implementation using the FFmpeg and FFprobe Binaries
+type ffmpegMedia struct{}
+
+func (ffmpegMedia) Probe(ctx context.Context, inputFilepath string) (MediaInfo, error) {
+	var info MediaInfo
+	var Probe struct {
+		Streams []struct {
+			Index            int       `json:"index"`
+			CodecName        string    `json:"codec_name"`
+			CodecType        string    `json:"codec_type"`
+			Width            int       `json:"width"`
+			Height           int       `json:"height"`
+			Channels         int       `json:"channels"`
+			AverageFrameRate framerate `json:"avg_frame_rate"`
+		} `json:"streams"`
+		Format struct {
+			Duration float `json:"duration"`
+		} `json:"format"`
+	}
+	proc := ffmpegCommand(
+		ctx,
+		"ffprobe",
+		"-v", "error",
+		"-i", inputFilepath,
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+	)
+	output := bytes.Buffer{}
+	proc.Stderr = &output
+	proc.Stdout = &output
+	if err := proc.Run(); err != nil {
+		return info, ffmpegError(err, output.String())
+	}
+
+	// Parse JSON Output
+	if err := json.Unmarshal(output.Bytes(), &Probe); err != nil {
+		return info, fmt.Errorf("invalid or malformed probe output: %w", err)
+	}
+	info.Duration = float64(Probe.Format.Duration)
+	for _, s := range Probe.Streams {
+		info.Streams = append(info.Streams, MediaStream{
+			Index:     s.Index,
+			Type:      s.CodecType,
+			Codec:     s.CodecName,
+			Width:     s.Width,
+			Height:    s.Height,
+			Framerate: int(s.AverageFrameRate),
+			Channels:  s.Channels,
+		})
+	}
+	return info, nil
+}
+
+func (ffmpegMedia) Encode(ctx context.Context, job TranscodeJob, progress func(percent float64)) error {
+	// Without a framerate the source timing is kept as is, including fractional rates
+	// Seeking happens on the input so the output and its progress start from zero
+	args := []string{
+		"-y",
+		"-v", "error",
+		"-progress", "pipe:1",
+	}
+	if job.Start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(job.Start, 'f', 3, 64))
+	}
+	if job.End > 0 {
+		args = append(args, "-to", strconv.FormatFloat(job.End, 'f', 3, 64))
+	}
+	args = append(args,
+		"-i", job.Input,
+		"-c:v", VIDEO_CODEC,
+		"-pix_fmt", VIDEO_PIXEL_FORMAT,
+		"-preset", job.Profile.Preset,
+		"-qp", job.Profile.Quality,
+		"-vf", "scale=-1:"+strconv.Itoa(job.Height),
+	)
+	if job.Framerate > 0 {
+		args = append(args, "-r", strconv.Itoa(job.Framerate))
+	}
+	args = append(args, ffmpegAudioArgs(job)...)
+	args = append(args, job.Output)
+	return ffmpegRun(ffmpegCommand(ctx, "ffmpeg", args...), job.Duration, progress)
+}
+
+// Build the Arguments that Map and Filter the Audio Tracks of an Encode
+// - Merged tracks are normalized together after merging, separate tracks are normalized on their own
+func ffmpegAudioArgs(job TranscodeJob) []string {
+	if len(job.Audio) == 0 {
+		return []string{"-map", "0:v:0", "-an"}
+	}
+	// Loudnorm upsamples to 192kHz so the output is brought back down to a common rate
+	normalize := ""
+	if job.Profile.AudioNormalize {
+		normalize = "loudnorm=I=-16:TP=-1.5:LRA=11,aresample=48000"
+	}
+	filters := []string{}
+	outputs := []string{}
+	for i, t := range job.Audio {
+		chain := []string{}
+		if t.Volume != 1 {
+			chain = append(chain, "volume="+strconv.FormatFloat(t.Volume, 'f', -1, 64))
+		}
+		if job.AudioSeparate && normalize != "" {
+			chain = append(chain, normalize)
+		}
+		if len(chain) == 0 {
+			chain = append(chain, "anull")
+		}
+		label := "[a" + strconv.Itoa(i) + "]"
+		filters = append(filters, "[0:a:"+strconv.Itoa(t.Track)+"]"+strings.Join(chain, ",")+label)
+		outputs = append(outputs, label)
+	}
+	if !job.AudioSeparate {
+		merge := strings.Join(outputs, "") + "amerge=inputs=" + strconv.Itoa(len(outputs))
+		if len(outputs) == 1 {
+			merge = outputs[0] + "anull"
+		}
+		if normalize != "" {
+			merge += "," + normalize
+		}
+		filters = append(filters, merge+"[a]")
+		outputs = []string{"[a]"}
+	}
+	args := []string{"-filter_complex", strings.Join(filters, ";"), "-map", "0:v:0"}
+	for _, o := range outputs {
+		args = append(args, "-map", o)
+	}
+	return append(args,
+		"-c:a", AUDIO_CODEC,
+		"-b:a", job.Profile.AudioBitrate,
+		"-ac", job.Profile.AudioChannels,
+	)
+}
+
+func (ffmpegMedia) Stream(ctx context.Context, job StreamJob, progress func(percent float64)) error {
+	var (
+		filterSplit = "[0:v]split=" + strconv.Itoa(len(job.Renditions))
+		filterScale = ""
+		streamMap   = []string{}
+		args        = []string{
+			"-y",
+			"-v", "error",
+			"-progress", "pipe:1",
+			"-i", job.Input,
+		}
+	)
+	for i, height := range job.Renditions {
+		filterSplit += "[s" + strconv.Itoa(i) + "]"
+		filterScale += ";[s" + strconv.Itoa(i) + "]scale=-2:" + strconv.Itoa(height) + "[v" + strconv.Itoa(i) + "]"
+		args = append(args, "-map", "[v"+strconv.Itoa(i)+"]")
+		if job.Audio {
+			args = append(args, "-map", "0:a:0")
+			streamMap = append(streamMap, fmt.Sprintf("v:%[1]d,a:%[1]d,name:%[2]dp", i, height))
+		} else {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,name:%dp", i, height))
+		}
+	}
+	args = append(args,
+		"-filter_complex", filterSplit+filterScale,
+		"-c:v", VIDEO_CODEC,
+		"-pix_fmt", VIDEO_PIXEL_FORMAT,
+		"-preset", job.Profile.Preset,
+		"-qp", job.Profile.Quality,
+		"-c:a", "copy",
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(HLS_SEGMENT_LENGTH),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", path.Join(job.Directory, "%v_%03d.ts"),
+		"-master_pl_name", OUTPUT_FILENAME_PLAYLIST,
+		"-var_stream_map", strings.Join(streamMap, " "),
+		path.Join(job.Directory, "%v.m3u8"),
+	)
+	return ffmpegRun(ffmpegCommand(ctx, "ffmpeg", args...), job.Duration, progress)
+}
+
+func (ffmpegMedia) Thumbnail(ctx context.Context, job ThumbnailJob) error {
+	// Look for the first frame that isn't mostly black within a short window,
+	// if there are none then settle for the frame at the position instead
+	// The image muxer only writes a file once a frame arrives, so an empty or missing file means nothing was captured
+	scale := "scale=-1:" + strconv.Itoa(job.Height)
+	for _, filter := range []string{
+		"blackframe=amount=0,metadata=mode=select:key=lavfi.blackframe.pblack:value=90:function=less," + scale,
+		scale,
+	} {
+		os.Remove(job.Output)
+		proc := ffmpegCommand(
+			ctx,
+			"ffmpeg",
+			"-y",
+			"-v", "error",
+			"-ss", strconv.FormatFloat(job.Position, 'f', 3, 64),
+			"-t", "30",
+			"-i", job.Input,
+			"-vf", filter,
+			"-frames:v", "1",
+			"-f", "image2",
+			"-update", "1",
+			job.Output,
+		)
+		if b, err := proc.CombinedOutput(); err != nil {
+			return ffmpegError(err, string(b))
+		}
+		if s, err := os.Stat(job.Output); err == nil && s.Size() > 0 {
+			return nil
+		}
+	}
+	return errors.New("no frames could be captured")
+}
+
+func (ffmpegMedia) Sprites(ctx context.Context, job SpriteJob, progress func(percent float64)) error {
+	proc := ffmpegCommand(
+		ctx,
+		"ffmpeg",
+		"-y",
+		"-v", "error",
+		"-progress", "pipe:1",
+		"-i", job.Input,
+		"-an",
+		"-vf", fmt.Sprintf(
+			"fps=1/%s,scale=%d:%d,tile=%dx%d",
+			strconv.FormatFloat(job.Interval, 'f', 3, 64), job.Width, job.Height, job.Columns, job.Rows,
+		),
+		"-frames:v", "1",
+		"-q:v", "5",
+		job.Output,
+	)
+	return ffmpegRun(proc, job.Duration, progress)
+}
+
+func (ffmpegMedia) Animate(ctx context.Context, job AnimationJob) error {
+	// GIFs only have 256 colours so a palette is generated from the clip first for better quality
+	filter := fmt.Sprintf("fps=%d,scale=-2:%d", job.Framerate, job.Height)
+	args := []string{
+		"-y",
+		"-v", "error",
+		"-ss", strconv.FormatFloat(job.Start, 'f', 3, 64),
+		"-t", strconv.FormatFloat(job.Duration, 'f', 3, 64),
+		"-i", job.Input,
+		"-an",
+	}
+	switch strings.ToLower(path.Ext(job.Output)) {
+	case ".webp":
+		args = append(args, "-vf", filter, "-c:v", "libwebp", "-q:v", "70")
+	case ".gif":
+		args = append(args, "-vf", filter+":flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse")
+	default:
+		return fmt.Errorf("unsupported animation format '%s'", path.Ext(job.Output))
+	}
+	args = append(args, "-loop", "0", job.Output)
+	if b, err := ffmpegCommand(ctx, "ffmpeg", args...).CombinedOutput(); err != nil {
+		return ffmpegError(err, string(b))
+	}
+	return nil
+}
+
+// Run an FFmpeg Command that was given "-progress pipe:1", reporting its progress through a video of the given duration
+func ffmpegRun(proc *exec.Cmd, duration float64, progress func(percent float64)) error {
+	output := bytes.Buffer{}
+	proc.Stderr = &output
+	p, _ := proc.StdoutPipe()
+	go streamProgress(p, duration, progress)
+	if err := proc.Run(); err != nil {
+		return ffmpegError(err, output.String())
+	}
+	return nil
+}
+
+// Describe a Failed Command by what it printed, otherwise by why it couldn't run
+func ffmpegError(err error, output string) error {
+	if output = strings.TrimSpace(output); output != "" {
+		return errors.New(output)
+	}
+	return err
+}
+
+// Build an FFmpeg or FFprobe Command following the configured Resource Limits
+// - Threads are limited for the output, which FFmpeg expects to be the last argument
+func ffmpegCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if name == "ffmpeg" && LIMIT_THREADS > 0 && len(args) > 0 {
+		output := args[len(args)-1]
+		args = append(args[:len(args)-1:len(args)-1], "-threads", strconv.Itoa(LIMIT_THREADS), output)
+	}
+	if LIMIT_NICE != 0 {
+		args = append([]string{"-n", strconv.Itoa(LIMIT_NICE), name}, args...)
+		name = "nice"
+	}
+	return exec.CommandContext(ctx, name, args...)
+}
+
+// Parse FFmpeg Progress Output and Report it as a Percentage of the Given Duration (in seconds)
+func streamProgress(r io.Reader, duration float64, callback func(percent float64)) {
+	for {
+		// Parse Progress
+		b := make([]byte, 256)
+		n, err := r.Read(b)
+		if err != nil {
+			return
+		}
+		m := map[string]string{}
+		for _, line := range strings.Split(string(b[:n]), "\n") {
+			s := strings.SplitN(line, "=", 2)
+			if len(s) == 2 {
+				m[s[0]] = strings.TrimSpace(s[1])
+			}
+		}
+		switch m["progress"] {
+		case "continue":
+			o, err := strconv.ParseFloat(m["out_time_us"], 64)
+			if err != nil {
+				return
+			}
+			// Convert to Milliseconds
+			total := math.Floor(duration * 1000)
+			progress := o / 1000
+			callback(min((progress/total)*100, 100))
+		case "end":
+			return
+		}
+	}
+}
+
+// Some custom types since some values are wrapped in quotes and it trips up the json unmarshaller
+
+// Parses the 1/60000 or whatever as a rounded integer
+type framerate int
+
+func (f *framerate) UnmarshalJSON(b []byte) error {
+	s := strings.SplitN(strings.Trim(string(b), "\""), "/", 2)
+	if len(s) != 2 {
+		return errors.New("incorrect amount of segments")
+	}
+	x, err := strconv.ParseFloat(s[0], 32)
+	if err != nil {
+		return err
+	}
+	y, err := strconv.ParseFloat(s[1], 32)
+	if err != nil {
+		return err
+	}
+	*f = framerate(math.Round(x / y))
+	return nil
+}
+
+// Parses a float string as a float64 (e.g. "123.123" => 123.123)
+type float float64
+
+func (f *float) UnmarshalJSON(b []byte) error {
+	v, err := strconv.ParseFloat(strings.Trim(string(b), "\""), 64)
+	if err != nil {
+		return err
+	}
+	*f = float(v)
+	return nil
+}
@@ -0,0 +1,80 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFFmpegAudioArgs(t *testing.T) {
+	output := []string{"-c:a", AUDIO_CODEC, "-b:a", "320K", "-ac", "2"}
+	loudnorm := "loudnorm=I=-16:TP=-1.5:LRA=11,aresample=48000"
+	tests := []struct {
+		name      string
+		audio     []AudioTrack
+		separate  bool
+		normalize bool
+		expected  []string
+	}{
+		{"silent", nil, false, true, []string{"-map", "0:v:0", "-an"}},
+		{
+			"single", []AudioTrack{{Track: 0, Volume: 1}}, false, false,
+			append([]string{"-filter_complex", "[0:a:0]anull[a0];[a0]anull[a]", "-map", "0:v:0", "-map", "[a]"}, output...),
+		},
+		{
+			"merged", []AudioTrack{{Track: 0, Volume: 1}, {Track: 2, Volume: 0.5}}, false, true,
+			append([]string{
+				"-filter_complex", "[0:a:0]anull[a0];[0:a:2]volume=0.5[a1];[a0][a1]amerge=inputs=2," + loudnorm + "[a]",
+				"-map", "0:v:0", "-map", "[a]",
+			}, output...),
+		},
+		{
+			"separate", []AudioTrack{{Track: 1, Volume: 2}, {Track: 0, Volume: 1}}, true, true,
+			append([]string{
+				"-filter_complex", "[0:a:1]volume=2," + loudnorm + "[a0];[0:a:0]" + loudnorm + "[a1]",
+				"-map", "0:v:0", "-map", "[a0]", "-map", "[a1]",
+			}, output...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := TranscodeJob{
+				Profile:       EncodeProfile{AudioBitrate: "320K", AudioChannels: "2", AudioNormalize: tt.normalize},
+				Audio:         tt.audio,
+				AudioSeparate: tt.separate,
+			}
+			if args := ffmpegAudioArgs(job); !slices.Equal(args, tt.expected) {
+				t.Errorf("Built arguments:\n%q\nexpected:\n%q", args, tt.expected)
+			}
+		})
+	}
+}
+
+func TestThumbnailFallback(t *testing.T) {
+	// Stand-in FFmpeg that leaves an empty file when looking for frames that aren't black
+	dir := t.TempDir()
+	script := `#!/bin/sh
+for output; do :; done
+case "$*" in
+*blackframe*) : > "$output" ;;
+*) echo frame > "$output" ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	nice, threads := LIMIT_NICE, LIMIT_THREADS
+	LIMIT_NICE, LIMIT_THREADS = 0, 0
+	t.Cleanup(func() { LIMIT_NICE, LIMIT_THREADS = nice, threads })
+
+	output := filepath.Join(dir, "thumbnail.jpg")
+	if err := (ffmpegMedia{}).Thumbnail(context.Background(), ThumbnailJob{Input: "input.mp4", Output: output, Height: 720}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(output); string(b) != "frame\n" {
+		t.Errorf("Thumbnail contains '%s', expected the frame at the position", b)
+	}
+}
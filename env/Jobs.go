@@ -0,0 +1,81 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"unicode/utf8"
+)
+
+const (
+	MAX_JOB_OUTPUT = 4096 // Amount of FFmpeg Output kept for each Attempt
+)
+
+var encoderHostname, _ = os.Hostname()
+
+// An Attempt at Encoding a Video
+type EncodeJob struct {
+	ID       int64   `json:"id"`
+	VideoID  string  `json:"video_id"`
+	Worker   string  `json:"worker"`
+	Codec    string  `json:"codec"`
+	Status   string  `json:"status"`
+	Started  string  `json:"started"`
+	Finished *string `json:"finished"`
+	Error    *string `json:"error"`
+	Output   *string `json:"output"`
+}
+
+// Record the Start of an Attempt
+func startEncodeJob(videoID string, workerId int) (int64, error) {
+	var jobID int64
+	err := DB.
+		QueryRow(
+			"INSERT INTO encode_jobs (video_id, worker, codec, status) VALUES ($1, $2, $3, 'PROCESS') RETURNING id",
+			videoID, fmt.Sprintf("%s/%d", encoderHostname, workerId), VIDEO_CODEC,
+		).
+		Scan(&jobID)
+	return jobID, err
+}
+
+// Record the Outcome of an Attempt, only the end of the output is kept as that's where FFmpeg explains itself
+func finishEncodeJob(jobID int64, status, errorMessage, errorOutput string) error {
+	if len(errorOutput) > MAX_JOB_OUTPUT {
+		// Cut at the start of a character so the kept output is still valid UTF-8
+		cut := len(errorOutput) - MAX_JOB_OUTPUT
+		for cut < len(errorOutput) && !utf8.RuneStart(errorOutput[cut]) {
+			cut++
+		}
+		errorOutput = "..." + errorOutput[cut:]
+	}
+	_, err := DB.Exec(
+		`UPDATE encode_jobs SET status = $1, finished = CURRENT_TIMESTAMP, error = NULLIF($2, ''), output = NULLIF($3, '')
+		WHERE id = $4`,
+		status, errorMessage, errorOutput, jobID,
+	)
+	return err
+}
+
+// Fetch Attempts newest first, empty filters match everything
+func ListEncodeJobs(videoID, status string, limit, offset int) ([]EncodeJob, error) {
+	rows, err := DB.Query(
+		`SELECT id, video_id, worker, codec, status, started, finished, error, output FROM encode_jobs
+		WHERE ($1 = '' OR video_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY id DESC LIMIT $3 OFFSET $4`,
+		videoID, status, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []EncodeJob{}
+	for rows.Next() {
+		var j EncodeJob
+		if err := rows.Scan(
+			&j.ID, &j.VideoID, &j.Worker, &j.Codec, &j.Status, &j.Started, &j.Finished, &j.Error, &j.Output,
+		); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
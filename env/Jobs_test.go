@@ -0,0 +1,26 @@
+package env
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFinishEncodeJobOutput(t *testing.T) {
+	videoID, _ := queueTestVideo(t, "default")
+	jobID, err := startEncodeJob(videoID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cutting at the limit would land in the middle of a character
+	output := "x" + strings.Repeat("é€", MAX_JOB_OUTPUT/5+1)
+	if err := finishEncodeJob(jobID, "ERROR", "Encode Error", output); err != nil {
+		t.Fatal(err)
+	}
+	var kept string
+	DB.QueryRow("SELECT output FROM encode_jobs WHERE id = $1", jobID).Scan(&kept)
+	if !utf8.ValidString(kept) || !strings.HasPrefix(kept, "...") || !strings.HasSuffix(output, kept[3:]) || len(kept) > MAX_JOB_OUTPUT+3 {
+		t.Errorf("Kept %d bytes of output that are valid UTF-8 %t, expected the end of the output", len(kept), utf8.ValidString(kept))
+	}
+}
@@ -0,0 +1,104 @@
+package env
+
+import "context"
+
+// Reads the Details of Media Files
+type Prober interface {
+	// Read the Duration and Streams of a Local File
+	Probe(ctx context.Context, inputFilepath string) (MediaInfo, error)
+}
+
+// Encodes Videos for Playback
+type Transcoder interface {
+	// Encode a Video into a single File, reporting progress as a percentage
+	Encode(ctx context.Context, job TranscodeJob, progress func(percent float64)) error
+	// Split an Encoded Video into Renditions for Adaptive Streaming, reporting progress as a percentage
+	Stream(ctx context.Context, job StreamJob, progress func(percent float64)) error
+}
+
+// Captures Images from Videos
+type Thumbnailer interface {
+	// Capture a Frame of a Video as an Image, skipping past black frames where possible
+	Thumbnail(ctx context.Context, job ThumbnailJob) error
+	// Capture evenly spaced Frames of a Video into a single Image, reporting progress as a percentage
+	Sprites(ctx context.Context, job SpriteJob, progress func(percent float64)) error
+	// Render part of a Video as a Looping Animated Image, the format follows the Output extension
+	Animate(ctx context.Context, job AnimationJob) error
+}
+
+var (
+	MediaProber      Prober      = ffmpegMedia{} // Media: Used to Probe Uploads, FFprobe by default
+	MediaTranscoder  Transcoder  = ffmpegMedia{} // Media: Used to Encode Videos, FFmpeg by default
+	MediaThumbnailer Thumbnailer = ffmpegMedia{} // Media: Used to Generate Thumbnails, FFmpeg by default
+)
+
+// Duration and Streams of a Media File
+type MediaInfo struct {
+	Duration float64 // Length in Seconds, 0 if unknown
+	Streams  []MediaStream
+}
+
+// A Single Stream within a Media File
+type MediaStream struct {
+	Index     int
+	Type      string // Either "video", "audio", "subtitle" or "data"
+	Codec     string
+	Width     int
+	Height    int
+	Framerate int // Average Framerate rounded to the nearest Integer
+	Channels  int
+}
+
+// Settings for Encoding a Video
+type TranscodeJob struct {
+	Input         string        // Path to the Original
+	Output        string        // Path to write the Encoded Video to
+	Profile       EncodeProfile // Quality Settings
+	Height        int           // Output Height, the Width is scaled to match
+	Framerate     int           // Output Framerate, 0 keeps the Source Framerate
+	Audio         []AudioTrack  // Audio Tracks to include, none leaves the Video silent
+	AudioSeparate bool          // Keep each Audio Track as its own Stream instead of merging them
+	Start         float64       // Seconds into the Original to start Encoding from
+	End           float64       // Seconds into the Original to stop Encoding at, 0 encodes until the end
+	Duration      float64       // Length of the Encoded Section in Seconds, used for Progress
+}
+
+// Settings for Generating an Adaptive Stream
+type StreamJob struct {
+	Input      string        // Path to the Encoded Video
+	Directory  string        // Directory to write the Playlists and Segments to
+	Profile    EncodeProfile // Quality Settings
+	Renditions []int         // Heights of each Rendition, tallest first
+	Audio      bool          // Does the Encoded Video have Audio? Only the first stream is streamed
+	Duration   float64       // Length of the Encoded Video in Seconds, used for Progress
+}
+
+// Settings for Generating a Thumbnail
+type ThumbnailJob struct {
+	Input    string  // Path to the Original
+	Output   string  // Path to write the Image to
+	Height   int     // Image Height, the Width is scaled to match
+	Position float64 // Seconds into the Video to start looking for a Frame
+}
+
+// Settings for Generating a Sprite Sheet, frames are placed left to right then top to bottom
+type SpriteJob struct {
+	Input    string  // Path to the Encoded Video
+	Output   string  // Path to write the Image to
+	Interval float64 // Seconds between each Frame
+	Columns  int     // Frames in each Row
+	Rows     int     // Rows in the Image
+	Width    int     // Width of each Frame
+	Height   int     // Height of each Frame
+	Duration float64 // Length of the Encoded Video in Seconds, used for Progress
+}
+
+// Settings for Generating an Animated Preview
+type AnimationJob struct {
+	Input     string  // Path to the Encoded Video
+	Output    string  // Path to write the Image to, either a .gif or .webp
+	Start     float64 // Seconds into the Video the Animation Starts
+	Duration  float64 // Length of the Animation in Seconds
+	Height    int     // Image Height, the Width is scaled to match
+	Framerate int     // Frames per Second
+}
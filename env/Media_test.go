@@ -0,0 +1,115 @@
+package env
+
+import (
+	"context"
+	"os"
+	"path"
+	"sync"
+	"testing"
+)
+
+// Stands in for FFmpeg so the Encoder can be tested without any Binaries
+// - Outputs are written as small placeholder files
+type fakeMedia struct {
+	mu         sync.Mutex
+	info       MediaInfo
+	probeErr   error
+	encodeErr  error
+	streamErr  error
+	thumbErr   error
+	hold       chan struct{} // Encode waits for this to be closed when set
+	started    chan struct{} // Closed once Encode was called when set
+	transcodes []TranscodeJob
+	streams    []StreamJob
+	thumbnails []ThumbnailJob
+	sprites    []SpriteJob
+	animations []AnimationJob
+}
+
+// Replace the Media Implementations with a Fake until the Test Finishes
+func useFakeMedia(t *testing.T, info MediaInfo) *fakeMedia {
+	f := &fakeMedia{info: info}
+	prober, transcoder, thumbnailer := MediaProber, MediaTranscoder, MediaThumbnailer
+	MediaProber, MediaTranscoder, MediaThumbnailer = f, f, f
+	t.Cleanup(func() {
+		MediaProber, MediaTranscoder, MediaThumbnailer = prober, transcoder, thumbnailer
+	})
+	return f
+}
+
+// A 30 Second 1080p Recording at 60 FPS with Two Audio Tracks
+func fakeRecording() MediaInfo {
+	return MediaInfo{
+		Duration: 30,
+		Streams: []MediaStream{
+			{Index: 0, Type: "video", Codec: "h264", Width: 1920, Height: 1080, Framerate: 60},
+			{Index: 1, Type: "audio", Codec: "aac", Channels: 2},
+			{Index: 2, Type: "audio", Codec: "aac", Channels: 2},
+		},
+	}
+}
+
+func (f *fakeMedia) Probe(ctx context.Context, inputFilepath string) (MediaInfo, error) {
+	if _, err := os.Stat(inputFilepath); err != nil {
+		return MediaInfo{}, err
+	}
+	return f.info, f.probeErr
+}
+
+func (f *fakeMedia) Encode(ctx context.Context, job TranscodeJob, progress func(percent float64)) error {
+	f.mu.Lock()
+	f.transcodes = append(f.transcodes, job)
+	f.mu.Unlock()
+	if f.started != nil {
+		close(f.started)
+	}
+	progress(50)
+	if f.hold != nil {
+		select {
+		case <-f.hold:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if f.encodeErr != nil {
+		return f.encodeErr
+	}
+	progress(100)
+	return os.WriteFile(job.Output, []byte("video"), FILE_MODE)
+}
+
+func (f *fakeMedia) Stream(ctx context.Context, job StreamJob, progress func(percent float64)) error {
+	f.mu.Lock()
+	f.streams = append(f.streams, job)
+	f.mu.Unlock()
+	if f.streamErr != nil {
+		return f.streamErr
+	}
+	progress(100)
+	return os.WriteFile(path.Join(job.Directory, OUTPUT_FILENAME_PLAYLIST), []byte("#EXTM3U"), FILE_MODE)
+}
+
+func (f *fakeMedia) Thumbnail(ctx context.Context, job ThumbnailJob) error {
+	f.mu.Lock()
+	f.thumbnails = append(f.thumbnails, job)
+	f.mu.Unlock()
+	if f.thumbErr != nil {
+		return f.thumbErr
+	}
+	return os.WriteFile(job.Output, []byte("image"), FILE_MODE)
+}
+
+func (f *fakeMedia) Sprites(ctx context.Context, job SpriteJob, progress func(percent float64)) error {
+	f.mu.Lock()
+	f.sprites = append(f.sprites, job)
+	f.mu.Unlock()
+	progress(100)
+	return os.WriteFile(job.Output, []byte("image"), FILE_MODE)
+}
+
+func (f *fakeMedia) Animate(ctx context.Context, job AnimationJob) error {
+	f.mu.Lock()
+	f.animations = append(f.animations, job)
+	f.mu.Unlock()
+	return os.WriteFile(job.Output, []byte("image"), FILE_MODE)
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"strings"
 
 	_ "github.com/joho/godotenv/autoload"
 )
@@ -16,6 +17,9 @@ const (
 	FILE_MODE       = os.FileMode(0600) // Read/Write for the Current User
 	MAX_FILE_SIZE   = 4 << 30           // Limited to 4 GB
 	COOKIE_LIFETIME = 7 * 24 * 60 * 60  // 7 days
+	MAX_TITLE       = 100               // Maximum Video Title Length
+	MAX_DESCRIPTION = 2000              // Maximum Video Description Length
+	MAX_REPORT      = 1000              // Maximum Report Details Length
 )
 
 var (
@@ -26,16 +30,34 @@ var (
 	TLS_CERT          = EnvString("TLS_CERT", "tls_crt.pem")        // http: Path to TLS Certificate
 	TLS_KEY           = EnvString("TLS_KEY", "tls_key.pem")         // http: Path to TLS Key
 	TLS_CA            = EnvString("TLS_CA", "tls_ca.pem")           // http: Path to TLS CA Bundle
-	DISCORD_REDIRECT  = EnvString("DISCORD_REDIRECT", "")           // Discord: Application Redirect URI
-	DISCORD_CLIENT_ID = EnvString("DISCORD_CLIENT_ID", "")          // Discord: Application Client ID
-	DISCORD_SECRET    = EnvString("DISCORD_SECRET", "")             // Discord: Application Secret Key
+	DISCORD_REDIRECT  = os.Getenv("DISCORD_REDIRECT")               // Discord: Application Redirect URI, required by the web server
+	DISCORD_CLIENT_ID = os.Getenv("DISCORD_CLIENT_ID")              // Discord: Application Client ID, required by the web server
+	DISCORD_SECRET    = os.Getenv("DISCORD_SECRET")                 // Discord: Application Secret Key, required by the web server
+	ADMIN_USER_IDS    = map[string]bool{}                           // Discord IDs of Administrators
+	TRUSTED_PROXIES   = []string{}                                  // http: Proxies allowed to set X-Forwarded-For, none by default
+	REPORTS_PER_HOUR  = EnvNumber("REPORTS_PER_HOUR", 10)           // Reports: Limit per IP Address every hour
+	REPORTS_AUTO_HIDE = EnvNumber("REPORTS_AUTO_HIDE", 0)           // Reports: Hide videos reported by this many people, 0 to disable
+	REPORT_REASONS    = map[string]bool{                            // Reports: Accepted Categories
+		"spam":      true,
+		"abuse":     true,
+		"copyright": true,
+		"illegal":   true,
+		"other":     true,
+	}
 )
 
 func init() {
-	// Initialize Data Directories
-	for _, dirname := range []string{"public", "video"} {
-		if err := os.MkdirAll(path.Join(DATA_DIR, dirname), FILE_MODE); err != nil {
-			log.Fatalln("[env/data]", err)
+	// Parse Administrator IDs
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ADMIN_USER_IDS[id] = true
+		}
+	}
+
+	// Parse Trusted Proxies
+	for _, p := range strings.Split(os.Getenv("HTTP_TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			TRUSTED_PROXIES = append(TRUSTED_PROXIES, p)
 		}
 	}
 
@@ -67,6 +89,18 @@ func init() {
 	}
 }
 
+// Prepare the Data Directory, Storage Backend and Share Secret
+// - Kept out of init() so that importing the package has no side effects, remote workers never call this
+func SetupData() {
+	for _, dirname := range []string{"public", "video", "temp"} {
+		if err := os.MkdirAll(path.Join(DATA_DIR, dirname), FILE_MODE); err != nil {
+			log.Fatalln("[env/data]", err)
+		}
+	}
+	setupStorage()
+	setupShareSecret()
+}
+
 // Reads String from Environment
 func EnvString(key, defaultValue string) string {
 	systemValue := os.Getenv(key)
@@ -80,6 +114,16 @@ func EnvString(key, defaultValue string) string {
 	return systemValue
 }
 
+// Exit if any of the Variables were not set, for options that aren't needed by every command
+func EnvRequire(keys ...string) {
+	for _, key := range keys {
+		if os.Getenv(key) == "" {
+			fmt.Printf("Variable '%s' was not set\n", key)
+			os.Exit(2)
+		}
+	}
+}
+
 // Read Number from Environment
 func EnvNumber(key string, defaultValue int) int {
 	systemValue := os.Getenv(key)
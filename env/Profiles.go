@@ -0,0 +1,91 @@
+package env
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+)
+
+var (
+	PROFILES_FILE    = EnvString("ENCODER_PROFILES_FILE", "profiles.json") // Profiles: Path to the Encoding Profiles, ignored if missing
+	PROFILE_DEFAULT  = EnvString("ENCODER_PROFILE_DEFAULT", "default")     // Profiles: Profile used when an Upload doesn't choose one
+	ENCODER_PROFILES = map[string]EncodeProfile{}                          // Profiles: Name => Encoding Settings
+)
+
+// Settings used to Encode a Video
+type EncodeProfile struct {
+	Description    string `json:"description"`     // Shown to Uploaders
+	Preset         string `json:"preset"`          // Encoder Speed Preset
+	Quality        string `json:"quality"`         // Constant Quantizer, lower is better
+	HeightLimit    int    `json:"height_limit"`    // Largest Output Height, 0 keeps the Source Height
+	FPSLimit       int    `json:"fps_limit"`       // Highest Output Framerate, 0 keeps the Source Framerate
+	AudioBitrate   string `json:"audio_bitrate"`   // Audio Bitrate, e.g. 320K
+	AudioChannels  string `json:"audio_channels"`  // Number of Audio Channels in the Output
+	AudioNormalize bool   `json:"audio_normalize"` // Apply Loudness Normalization to each Audio Stream?
+}
+
+// Load the Encoding Profiles from the Profiles File
+// - Kept out of init() so that importing the package has no side effects, remote workers are sent their profile instead
+func SetupProfiles() error {
+	// The Default Profile mirrors the Encoder Options so it applies to videos from before profiles existed
+	ENCODER_PROFILES["default"] = EncodeProfile{
+		Description:    "Default",
+		Preset:         VIDEO_PRESET,
+		Quality:        VIDEO_QUALITY,
+		HeightLimit:    VIDEO_HEIGHT_LIMIT,
+		FPSLimit:       VIDEO_FPS_LIMIT,
+		AudioBitrate:   AUDIO_BITRATE,
+		AudioChannels:  AUDIO_CHANNELS,
+		AudioNormalize: AUDIO_NORMALIZE,
+	}
+
+	// Fields left out of a profile use the value from the Default Profile, except for its description
+	b, err := os.ReadFile(PROFILES_FILE)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot read profiles: %w", err)
+	}
+	if err == nil {
+		var profiles map[string]json.RawMessage
+		if err := json.Unmarshal(b, &profiles); err != nil {
+			return fmt.Errorf("invalid profiles: %w", err)
+		}
+		fallback := ENCODER_PROFILES["default"]
+		for name, raw := range profiles {
+			p := fallback
+			p.Description = ""
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return fmt.Errorf("invalid profile '%s': %w", name, err)
+			}
+			if p.Preset == "" || p.Quality == "" || p.AudioBitrate == "" || p.AudioChannels == "" || p.HeightLimit < 0 || p.FPSLimit < 0 {
+				return fmt.Errorf("invalid profile '%s': missing or negative values", name)
+			}
+			ENCODER_PROFILES[name] = p
+		}
+	}
+	if _, ok := ENCODER_PROFILES[PROFILE_DEFAULT]; !ok {
+		return fmt.Errorf("default profile '%s' does not exist", PROFILE_DEFAULT)
+	}
+	return nil
+}
+
+// Lookup an Encoding Profile by Name
+// - Profiles removed from the configuration fall back to the Default Profile
+func lookupProfile(name string) EncodeProfile {
+	if p, ok := ENCODER_PROFILES[name]; ok {
+		return p
+	}
+	log.Printf("[env/profiles] Unknown Profile '%s', using '%s'\n", name, PROFILE_DEFAULT)
+	return ENCODER_PROFILES[PROFILE_DEFAULT]
+}
+
+// Names of every Encoding Profile in Alphabetical Order
+func ProfileNames() []string {
+	names := make([]string, 0, len(ENCODER_PROFILES))
+	for name := range ENCODER_PROFILES {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
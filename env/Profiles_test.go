@@ -0,0 +1,39 @@
+package env
+
+import (
+	"maps"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSetupProfiles(t *testing.T) {
+	profilesFile, profiles := PROFILES_FILE, maps.Clone(ENCODER_PROFILES)
+	t.Cleanup(func() { PROFILES_FILE, ENCODER_PROFILES = profilesFile, profiles })
+
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"inherits", `{"small": {"description": "Small", "height_limit": 480}}`, true},
+		{"malformed", `{"small": `, false},
+		{"negative", `{"small": {"fps_limit": -1}}`, false},
+		{"wrong type", `{"small": {"quality": 27}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			PROFILES_FILE, ENCODER_PROFILES = path.Join(t.TempDir(), "profiles.json"), map[string]EncodeProfile{}
+			if err := os.WriteFile(PROFILES_FILE, []byte(tt.content), FILE_MODE); err != nil {
+				t.Fatal(err)
+			}
+			err := SetupProfiles()
+			if (err == nil) != tt.valid {
+				t.Fatalf("SetupProfiles() returned %v, expected valid to be %t", err, tt.valid)
+			}
+			if p := ENCODER_PROFILES["small"]; tt.valid && (p.HeightLimit != 480 || p.Preset != VIDEO_PRESET) {
+				t.Errorf("Profile is %+v, expected a height limit of 480 and the default preset", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package env
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+)
+
+// How long an Upload waits for its Duration to be read before it is queued without one
+const queueProbeTimeout = 10 * time.Second
+
+var (
+	QUEUE_SHORT_CLIP  = EnvNumber("QUEUE_SHORT_CLIP", 60)  // Queue: Clips up to this many seconds long are encoded first
+	QUEUE_ETA_SAMPLES = EnvNumber("QUEUE_ETA_SAMPLES", 20) // Queue: Recent encodes per codec used to estimate wait times
+	encoderWake       = make(chan struct{}, max(ENCODER_WORKERS, 1))
+	queueChanged      = make(chan struct{}, 1)
+)
+
+// Position of a Queued Video and the Estimated Seconds until it starts Encoding
+// - ETA is nil until enough videos have been encoded to estimate it
+type QueueEntry struct {
+	Position int    `json:"position"`
+	ETA      *int64 `json:"eta"`
+	userID   string
+}
+
+// Orders Queued Videos for Encoding
+// - Each user's videos are ordered shortest clips first and then oldest first
+// - Users take turns, with users that already have videos being encoded waiting longer
+// - Videos waiting to be retried are left out until they are due
+const queueSQL = `
+	WITH ranked AS (
+		SELECT id, created, user_id, duration, COALESCE(duration <= $1, 0) AS short,
+			ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY COALESCE(duration <= $1, 0) DESC, created) +
+			(SELECT COUNT(*) FROM videos p WHERE p.user_id = v.user_id AND p.status = 'PROCESS') AS turn
+		FROM videos v
+		WHERE status = 'QUEUE' AND (retry_after IS NULL OR retry_after <= CURRENT_TIMESTAMP)
+	),
+	queue AS (
+		SELECT id, created, user_id, duration, ROW_NUMBER() OVER (ORDER BY turn, short DESC, created) AS position
+		FROM ranked
+	)`
+
+// Wake up a sleeping encoder to start working
+func WakeEncoder() {
+	select {
+	case encoderWake <- struct{}{}:
+	default:
+		// Every encoder is already going to look for work
+	}
+	notifyQueue()
+}
+
+// Let Users know their Videos moved in the Queue
+func notifyQueue() {
+	select {
+	case queueChanged <- struct{}{}:
+	default:
+		// Positions are already going to be sent
+	}
+}
+
+// Send the Position of each Queued Video to its Owner whenever the Queue changes
+// - Bursts of changes are sent together and unchanged positions are skipped
+func startQueueNotifier(stop context.Context) {
+	sent := map[string]QueueEntry{}
+	for {
+		select {
+		case <-queueChanged:
+		case <-stop.Done():
+			return
+		}
+		entries, err := QueueStatus()
+		if err != nil {
+			log.Println("[env/queue] Cannot Read Queue:", err)
+			continue
+		}
+		for videoID, e := range entries {
+			if last, ok := sent[videoID]; ok && last.Position == e.Position && equalETA(last.ETA, e.ETA) {
+				continue
+			}
+			SendEvent(e.userID, "VIDEO_QUEUE_POSITION", videoID, e)
+		}
+		sent = entries
+		select {
+		case <-time.After(time.Second):
+		case <-stop.Done():
+			return
+		}
+	}
+}
+
+func equalETA(a, b *int64) bool {
+	return a == b || (a != nil && b != nil && *a == *b)
+}
+
+// Take the Next Video from the Queue and mark it as Processing
+// - Returns sql.ErrNoRows if there is nothing to do
+func claimVideo() (videoID, videoCreated, userID, profile string, trim VideoTrim, audio VideoAudio, err error) {
+	err = DB.
+		QueryRow(
+			queueSQL+`
+			UPDATE videos SET status = 'PROCESS'
+			WHERE id = (SELECT id FROM queue ORDER BY position LIMIT 1) AND status = 'QUEUE'
+			RETURNING id, created, user_id, profile, trim_start, trim_end, audio`,
+			QUEUE_SHORT_CLIP,
+		).
+		Scan(&videoID, &videoCreated, &userID, &profile, &trim.Start, &trim.End, &audio)
+	return
+}
+
+// Fetch the Position and ETA of every Queued Video, positions start from 1
+// - ETAs assume every encoder works through the queue in order at the recent speed of the configured codec
+// - Remote workers are counted as encoders while they hold a lease, idle ones cannot be seen
+func QueueStatus() (map[string]QueueEntry, error) {
+	speed, averageDuration, err := encodeSpeed()
+	if err != nil {
+		return nil, err
+	}
+	var remoteWorkers int
+	err = DB.
+		QueryRow("SELECT COUNT(DISTINCT worker) FROM encode_jobs WHERE status = 'PROCESS' AND lease_expires > CURRENT_TIMESTAMP").
+		Scan(&remoteWorkers)
+	if err != nil {
+		return nil, err
+	}
+	encoders := ENCODER_WORKERS + remoteWorkers
+
+	// Media left to encode by Videos already being Processed
+	var backlog float64
+	var processing int
+	rows, err := DB.Query(
+		`SELECT v.duration, (julianday('now') - julianday(MAX(j.started))) * 86400 FROM videos v
+		LEFT JOIN encode_jobs j ON j.video_id = v.id AND j.status = 'PROCESS'
+		WHERE v.status = 'PROCESS' GROUP BY v.id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var duration, elapsed *float64
+		if err := rows.Scan(&duration, &elapsed); err != nil {
+			return nil, err
+		}
+		remaining := averageDuration
+		if duration != nil {
+			remaining = *duration
+		}
+		if elapsed != nil {
+			remaining -= *elapsed * speed
+		}
+		backlog += max(remaining, 0)
+		processing++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// Queued Videos wait for everything before them
+	rows, err = DB.Query(queueSQL+" SELECT id, user_id, duration, position FROM queue ORDER BY position", QUEUE_SHORT_CLIP)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := map[string]QueueEntry{}
+	for rows.Next() {
+		var videoID string
+		var duration *float64
+		var e QueueEntry
+		if err := rows.Scan(&videoID, &e.userID, &duration, &e.Position); err != nil {
+			return nil, err
+		}
+		if speed > 0 && encoders > 0 {
+			var eta int64
+			if processing+e.Position > encoders {
+				eta = int64(math.Ceil(backlog / float64(encoders) / speed))
+			}
+			e.ETA = &eta
+		}
+		if duration != nil {
+			backlog += *duration
+		} else {
+			backlog += averageDuration
+		}
+		entries[videoID] = e
+	}
+	return entries, rows.Err()
+}
+
+// Seconds of Media Encoded per Second for the Configured Codec, along with the Average Duration of those Videos
+// - Falls back to every codec if the configured codec hasn't encoded anything yet, returns 0 without any history
+func encodeSpeed() (float64, float64, error) {
+	rows, err := DB.Query(
+		`SELECT codec, SUM(duration), SUM(elapsed), COUNT(*) FROM (
+			SELECT j.codec, v.duration, (julianday(j.finished) - julianday(j.started)) * 86400 AS elapsed,
+				ROW_NUMBER() OVER (PARTITION BY j.codec ORDER BY j.id DESC) AS n
+			FROM encode_jobs j JOIN videos v ON v.id = j.video_id
+			WHERE j.status = 'FINISH' AND v.duration IS NOT NULL
+		) WHERE n <= $1 GROUP BY codec`,
+		QUEUE_ETA_SAMPLES,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+	var media, elapsed, count, allMedia, allElapsed, allCount float64
+	for rows.Next() {
+		var codec string
+		var m, e, n float64
+		if err := rows.Scan(&codec, &m, &e, &n); err != nil {
+			return 0, 0, err
+		}
+		if codec == VIDEO_CODEC {
+			media, elapsed, count = m, e, n
+		}
+		allMedia, allElapsed, allCount = allMedia+m, allElapsed+e, allCount+n
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if elapsed <= 0 {
+		media, elapsed, count = allMedia, allElapsed, allCount
+	}
+	if elapsed <= 0 {
+		return 0, 0, nil
+	}
+	return media / elapsed, media / count, nil
+}
+
+// Read the Duration of a Local Video File in Seconds
+// - Returns nil if it cannot be determined quickly, the encoder will probe it again anyway
+func ProbeDuration(filepath string) *float64 {
+	ctx, cancel := context.WithTimeout(context.Background(), queueProbeTimeout)
+	defer cancel()
+	info, err := MediaProber.Probe(ctx, filepath)
+	if err != nil || info.Duration <= 0 {
+		return nil
+	}
+	return &info.Duration
+}
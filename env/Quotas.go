@@ -0,0 +1,102 @@
+package env
+
+import (
+	"database/sql"
+	"log"
+)
+
+var (
+	QUOTA_STORAGE = EnvNumber("QUOTA_STORAGE", 20<<30)   // Default Storage Limit per User in Bytes
+	QUOTA_VIDEOS  = EnvNumber("QUOTA_VIDEOS", 250)       // Default Video Limit per User
+	QUOTA_DAILY   = EnvNumber("QUOTA_DAILY_UPLOADS", 25) // Default Uploads per User every 24 hours
+)
+
+// Current Usage and Limits for a User, limits of zero are unlimited
+// Incomplete uploads count towards usage as if they were finished
+// Daily uploads are counted from the upload history so deleting a video doesn't free up a slot
+type Quota struct {
+	StorageUsed  int64 `json:"storage_used"`
+	StorageLimit int64 `json:"storage_limit"`
+	VideosUsed   int   `json:"videos_used"`
+	VideosLimit  int   `json:"videos_limit"`
+	DailyUsed    int   `json:"daily_used"`
+	DailyLimit   int   `json:"daily_limit"`
+}
+
+// Calculate the Usage and Limits for a User
+func GetQuota(userID string) (Quota, error) {
+	var q Quota
+	err := DB.
+		QueryRow(
+			`SELECT
+				COALESCE(u.quota_storage, $1),
+				COALESCE(u.quota_videos, $2),
+				COALESCE(u.quota_daily, $3),
+				(SELECT COALESCE(SUM(size), 0) FROM videos WHERE user_id = u.id) +
+				(SELECT COALESCE(SUM(size), 0) FROM uploads WHERE user_id = u.id),
+				(SELECT COUNT(*) FROM videos WHERE user_id = u.id) +
+				(SELECT COUNT(*) FROM uploads WHERE user_id = u.id),
+				(SELECT COUNT(*) FROM upload_history WHERE user_id = u.id AND created > datetime('now', '-1 day')) +
+				(SELECT COUNT(*) FROM uploads WHERE user_id = u.id AND created > datetime('now', '-1 day'))
+			FROM users u WHERE u.id = $4`,
+			QUOTA_STORAGE, QUOTA_VIDEOS, QUOTA_DAILY, userID,
+		).
+		Scan(&q.StorageLimit, &q.VideosLimit, &q.DailyLimit, &q.StorageUsed, &q.VideosUsed, &q.DailyUsed)
+	return q, err
+}
+
+// Check if the User can Upload a Video of the given Size
+// Returns a message for the user if they can't, otherwise an empty string
+func (q Quota) Check(size int64) string {
+	switch {
+	case q.VideosLimit > 0 && q.VideosUsed >= q.VideosLimit:
+		return "Video Limit Reached"
+	case q.DailyLimit > 0 && q.DailyUsed >= q.DailyLimit:
+		return "Daily Upload Limit Reached"
+	case q.StorageLimit > 0 && q.StorageUsed+size > q.StorageLimit:
+		return "Storage Quota Exceeded"
+	}
+	return ""
+}
+
+// Bytes the User can still Upload, or -1 if unlimited
+func (q Quota) Remaining() int64 {
+	if q.StorageLimit <= 0 {
+		return -1
+	}
+	return max(q.StorageLimit-q.StorageUsed, 0)
+}
+
+// Record a Finished Upload towards the Daily Limit of its User
+func RecordUpload(tx *sql.Tx, userID string) error {
+	_, err := tx.Exec("INSERT INTO upload_history (user_id) VALUES ($1)", userID)
+	return err
+}
+
+// Forget Uploads that no longer count towards the Daily Limit
+func pruneUploadHistory() error {
+	_, err := DB.Exec("DELETE FROM upload_history WHERE created <= datetime('now', '-1 day')")
+	return err
+}
+
+// Read the Size of Originals uploaded before sizes were recorded from Storage
+func backfillSizes() {
+	videoIDs, err := queryIDs("SELECT id FROM videos WHERE size = 0 AND original = 1")
+	if err != nil {
+		log.Println("[env/quotas] Cannot Backfill Sizes:", err)
+		return
+	}
+	for _, videoID := range videoIDs {
+		size, err := Storage.Stat("video/" + videoID)
+		if err != nil {
+			log.Printf("[env/quotas] Cannot Read Size of %s: %s\n", videoID, err)
+			continue
+		}
+		if _, err := DB.Exec("UPDATE videos SET size = $1 WHERE id = $2", size, videoID); err != nil {
+			log.Printf("[env/quotas] Cannot Store Size of %s: %s\n", videoID, err)
+		}
+	}
+	if len(videoIDs) > 0 {
+		log.Printf("[env/quotas] Backfilled sizes of %d videos\n", len(videoIDs))
+	}
+}
@@ -0,0 +1,47 @@
+package env
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuotaDeletedUploads(t *testing.T) {
+	videoID, userID := queueTestVideo(t, "default")
+	tx, err := DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordUpload(tx, userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteVideo(videoID); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := GetQuota(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.DailyUsed != 1 || q.VideosUsed != 0 {
+		t.Errorf("Counted %d daily uploads and %d videos, expected 1 and 0", q.DailyUsed, q.VideosUsed)
+	}
+}
+
+func TestBackfillSizes(t *testing.T) {
+	videoID, userID := queueTestVideo(t, "default")
+	if err := Storage.Put("video/"+videoID, strings.NewReader("a bigger original"), 17); err != nil {
+		t.Fatal(err)
+	}
+	backfillSizes()
+
+	q, err := GetQuota(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.StorageUsed != 17 {
+		t.Errorf("Counted %d bytes of storage, expected 17", q.StorageUsed)
+	}
+}
@@ -0,0 +1,248 @@
+package env
+
+import (
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// How long Files are left alone before they can be Orphans, as their row may not have been inserted yet
+const reconcileGrace = time.Hour
+
+var (
+	RECONCILE_ON_STARTUP = EnvString("RECONCILE_ON_STARTUP", "report") // Consistency: Either "off", "report" or "fix"
+)
+
+// Drift found between the Database and Storage
+type ReconcileReport struct {
+	OrphanOriginals  []string `json:"orphan_originals"`  // Originals without a Video
+	OrphanOutputs    []string `json:"orphan_outputs"`    // Outputs without a Video
+	OrphanPartials   []string `json:"orphan_partials"`   // Incomplete Uploads without an Upload
+	ErrorOutputs     []string `json:"error_outputs"`     // Outputs left behind by Failed Videos
+	MissingOriginals []string `json:"missing_originals"` // Videos whose Original is missing
+	MissingOutputs   []string `json:"missing_outputs"`   // Processed Videos whose Output is missing
+	MissingPartials  []string `json:"missing_partials"`  // Uploads whose Incomplete File and Original are both missing
+	Fixed            bool     `json:"fixed"`             // Was the Drift Corrected?
+}
+
+// Run a Reconcile before the Encoders start as configured
+func ReconcileStartup() {
+	switch RECONCILE_ON_STARTUP {
+	case "off":
+		return
+	case "report", "fix":
+	default:
+		log.Fatalln("[env/reconcile] Unknown Startup Mode:", RECONCILE_ON_STARTUP)
+	}
+	if _, err := Reconcile(RECONCILE_ON_STARTUP == "fix"); err != nil {
+		log.Println("[env/reconcile] Cannot Reconcile:", err)
+	}
+}
+
+type reconcileVideo struct {
+	status    string
+	original  bool
+	published bool
+}
+
+// Cross-check the Videos and Uploads tables against Storage
+// - Rows are read both before and after listing Storage, missing files are checked against the rows
+// from before and orphans against the rows from after, so work finishing while this runs isn't reported
+// - Nothing is changed unless fix is set
+func Reconcile(fix bool) (ReconcileReport, error) {
+	report := ReconcileReport{
+		OrphanOriginals:  []string{},
+		OrphanOutputs:    []string{},
+		OrphanPartials:   []string{},
+		ErrorOutputs:     []string{},
+		MissingOriginals: []string{},
+		MissingOutputs:   []string{},
+		MissingPartials:  []string{},
+		Fixed:            fix,
+	}
+
+	// Collect Database Rows and Stored Files
+	videosBefore, uploadsBefore, err := reconcileRows()
+	if err != nil {
+		return report, err
+	}
+	originalKeys, err := Storage.List("video/")
+	if err != nil {
+		return report, err
+	}
+	originals := map[string]bool{}
+	for _, key := range originalKeys {
+		if !strings.HasSuffix(key, ".part") {
+			originals[strings.TrimPrefix(key, "video/")] = true
+		}
+	}
+	outputKeys, err := Storage.List("public/")
+	if err != nil {
+		return report, err
+	}
+	outputs := map[string]bool{}
+	for _, key := range outputKeys {
+		id, file, _ := strings.Cut(strings.TrimPrefix(key, "public/"), "/")
+		outputs[id] = outputs[id] || path.Base(file) == OUTPUT_FILENAME_VIDEO
+	}
+
+	// Incomplete Uploads are always kept on disk
+	// Recently written files are skipped as they may belong to an upload still being created
+	partials := map[string]bool{}
+	entries, err := os.ReadDir(path.Join(DATA_DIR, "video"))
+	if err != nil {
+		return report, err
+	}
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".part")
+		if !ok {
+			continue
+		}
+		if i, err := e.Info(); err == nil && time.Since(i.ModTime()) > reconcileGrace {
+			partials[id] = true
+		} else {
+			partials[id] = false
+		}
+	}
+
+	videos, uploads, err := reconcileRows()
+	if err != nil {
+		return report, err
+	}
+
+	// Compare
+	for id := range originals {
+		if _, ok := videos[id]; !ok && !uploads[id] && reconcileSettled("video/"+id) {
+			report.OrphanOriginals = append(report.OrphanOriginals, id)
+		}
+	}
+	for id := range outputs {
+		v, ok := videos[id]
+		switch {
+		case !ok:
+			report.OrphanOutputs = append(report.OrphanOutputs, id)
+		case v.status == "ERROR" && !v.published:
+			report.ErrorOutputs = append(report.ErrorOutputs, id)
+		}
+	}
+	for id, old := range partials {
+		if !uploads[id] && old {
+			report.OrphanPartials = append(report.OrphanPartials, id)
+		}
+	}
+	for id, v := range videosBefore {
+		if v.original && !originals[id] {
+			report.MissingOriginals = append(report.MissingOriginals, id)
+		}
+		if v.published && !outputs[id] {
+			report.MissingOutputs = append(report.MissingOutputs, id)
+		}
+	}
+	// Uploads that failed to be queued keep their original in storage until finalized again or expired
+	for id := range uploadsBefore {
+		if _, ok := partials[id]; !ok && !originals[id] {
+			report.MissingPartials = append(report.MissingPartials, id)
+		}
+	}
+	log.Printf(
+		"[env/reconcile] Found %d orphan originals, %d orphan outputs, %d orphan partials, %d error outputs, "+
+			"%d missing originals, %d missing outputs, %d missing partials\n",
+		len(report.OrphanOriginals), len(report.OrphanOutputs), len(report.OrphanPartials), len(report.ErrorOutputs),
+		len(report.MissingOriginals), len(report.MissingOutputs), len(report.MissingPartials),
+	)
+	if !fix {
+		return report, nil
+	}
+
+	// Remove Unreferenced Files
+	for _, id := range report.OrphanOriginals {
+		reconcileFix(Storage.Delete("video/"+id), "Delete orphan original", id)
+	}
+	for _, id := range report.OrphanOutputs {
+		reconcileFix(Storage.Delete("public/"+id), "Delete orphan output", id)
+	}
+	for _, id := range report.ErrorOutputs {
+		reconcileFix(Storage.Delete("public/"+id), "Delete output of failed video", id)
+	}
+	for _, id := range report.OrphanPartials {
+		reconcileFix(os.Remove(path.Join(DATA_DIR, "video", id+".part")), "Delete orphan partial", id)
+	}
+
+	// Update Rows to match Storage
+	// Queued videos cannot be processed without their original
+	for _, id := range report.MissingOriginals {
+		_, err := DB.Exec(
+			`UPDATE videos SET original = 0,
+				status = CASE WHEN status = 'QUEUE' THEN 'ERROR' ELSE status END
+			WHERE id = $1`,
+			id,
+		)
+		reconcileFix(err, "Mark missing original for", id)
+	}
+	// Processed videos are queued again if their original is still around
+	requeue := false
+	for _, id := range report.MissingOutputs {
+		status := "ERROR"
+		if originals[id] {
+			status, requeue = "QUEUE", true
+		}
+		_, err := DB.Exec("UPDATE videos SET status = $1, published = 0 WHERE id = $2", status, id)
+		reconcileFix(err, "Mark missing output as "+status+" for", id)
+	}
+	for _, id := range report.MissingPartials {
+		_, err := DB.Exec("DELETE FROM uploads WHERE id = $1", id)
+		reconcileFix(err, "Delete upload without partial", id)
+	}
+	if requeue {
+		WakeEncoder()
+	}
+	return report, nil
+}
+
+// Read the Videos and Uploads Tables
+func reconcileRows() (map[string]reconcileVideo, map[string]bool, error) {
+	videos := map[string]reconcileVideo{}
+	rows, err := DB.Query("SELECT id, status, original, published FROM videos")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var v reconcileVideo
+		if err := rows.Scan(&id, &v.status, &v.original, &v.published); err != nil {
+			return nil, nil, err
+		}
+		videos[id] = v
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	rows.Close()
+
+	uploads := map[string]bool{}
+	uploadIDs, err := queryIDs("SELECT id FROM uploads")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, id := range uploadIDs {
+		uploads[id] = true
+	}
+	return videos, uploads, nil
+}
+
+// Has an Object gone unchanged long enough that it cannot belong to work still in progress?
+func reconcileSettled(key string) bool {
+	t, err := Storage.Modified(key)
+	return err == nil && time.Since(t) > reconcileGrace
+}
+
+func reconcileFix(err error, action, id string) {
+	if err != nil {
+		log.Printf("[env/reconcile] Cannot %s %s: %s\n", action, id, err)
+		return
+	}
+	log.Printf("[env/reconcile] %s %s\n", action, id)
+}
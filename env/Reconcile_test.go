@@ -0,0 +1,38 @@
+package env
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconcileFreshOriginal(t *testing.T) {
+	// An upload stores its original before inserting its row
+	for _, videoID := range []string{"freshOrphan", "staleOrphan"} {
+		if err := Storage.Put("video/"+videoID, strings.NewReader("original"), 8); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { Storage.Delete("video/" + videoID) })
+	}
+	stale := time.Now().Add(-reconcileGrace - time.Minute)
+	if err := os.Chtimes(path.Join(DATA_DIR, "video", "staleOrphan"), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Reconcile(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(report.OrphanOriginals, []string{"staleOrphan"}) {
+		t.Errorf("Found orphan originals %v, expected [staleOrphan]", report.OrphanOriginals)
+	}
+	if _, err := Storage.Stat("video/freshOrphan"); err != nil {
+		t.Errorf("Fresh original was deleted: %v", err)
+	}
+	if _, err := Storage.Stat("video/staleOrphan"); err == nil {
+		t.Error("Stale orphan original was kept")
+	}
+}
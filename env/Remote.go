@@ -0,0 +1,303 @@
+package env
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	WORKER_POLL  = EnvNumber("WORKER_POLL", 5)       // Workers: Seconds a Remote Worker waits before asking again when the queue is empty
+	WORKER_DIR   = EnvString("WORKER_DIR", "worker") // Workers: Work Directory of a Remote Worker, cleared on startup
+	errLeaseLost = errors.New("lease lost")
+)
+
+// An Unsuccessful Response from the Server
+type remoteError struct {
+	Status  int
+	Message string
+}
+
+func (e *remoteError) Error() string {
+	return fmt.Sprintf("%d %s", e.Status, e.Message)
+}
+
+// Client for the Worker Endpoints of the Main Server
+type remoteWorker struct {
+	server string
+	name   string
+	client http.Client
+}
+
+// Encode Videos Leased from the Main Server until stop is cancelled
+func StartRemoteWorker(stop context.Context, await *sync.WaitGroup, server, name string) {
+	// The work directory is cleared on startup, which would ruin a server sharing its data directory
+	worker, _ := filepath.Abs(WORKER_DIR)
+	data, _ := filepath.Abs(DATA_DIR)
+	if rel, err := filepath.Rel(data, worker); err == nil && !strings.HasPrefix(rel, "..") {
+		log.Fatalln("[env/remote] WORKER_DIR cannot be within the server's data directory:", WORKER_DIR)
+	}
+	setupEncoder(WORKER_DIR)
+	w := &remoteWorker{server: strings.TrimSuffix(server, "/"), name: name}
+	log.Printf("[env/remote] Working for %s as %s\n", w.server, w.name)
+
+	await.Add(1)
+	go func() {
+		defer await.Done()
+		for stop.Err() == nil {
+			lease, err := w.lease(stop)
+			if err != nil && stop.Err() == nil {
+				log.Println("[env/remote] Cannot Lease Video:", err)
+			}
+			if lease == nil {
+				select {
+				case <-time.After(time.Duration(WORKER_POLL) * time.Second):
+				case <-stop.Done():
+				}
+				continue
+			}
+			w.process(stop, *lease)
+		}
+		log.Println("[env/remote] Closed Worker")
+	}()
+}
+
+// Ask the Server for the Next Video, returns nil if there is nothing to do
+func (w *remoteWorker) lease(ctx context.Context) (*WorkerLease, error) {
+	b, _ := json.Marshal(map[string]string{"worker": w.name, "codec": VIDEO_CODEC})
+	resp, err := w.request(ctx, http.MethodPost, "/api/workers/lease", bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	var lease WorkerLease
+	if err := json.NewDecoder(resp.Body).Decode(&lease); err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// Encode a Leased Video and Report the Outcome to the Server
+// - Cancelling stop interrupts the video so the server can queue it again
+func (w *remoteWorker) process(stop context.Context, lease WorkerLease) {
+	var (
+		inputFilepath   = path.Join(WORKER_DIR, lease.VideoID+".original")
+		outputDirectory = path.Join(WORKER_DIR, lease.VideoID)
+		progress        atomic.Value
+	)
+	log.Printf("[env/remote] Leased Video: %s\n", lease.VideoID)
+	defer os.Remove(inputFilepath)
+	defer os.RemoveAll(outputDirectory)
+
+	// Keep the Lease while Working
+	ctx, cancel := context.WithCancel(stop)
+	defer cancel()
+	go w.renew(ctx, cancel, lease, &progress)
+
+	result := w.encode(ctx, lease, inputFilepath, outputDirectory, func(percent string) {
+		progress.Store(percent)
+	})
+	switch {
+	case stop.Err() != nil:
+		log.Printf("[env/remote] Encoding Interrupted (ID: %s)\n", lease.VideoID)
+		result = WorkerResult{Interrupted: true}
+	case ctx.Err() != nil:
+		log.Printf("[env/remote] Lease Lost (ID: %s)\n", lease.VideoID)
+		return
+	case result.Error != "":
+		log.Printf("[env/remote] Encoding Error (ID: %s): %s\nOutput: %s\n---\n", lease.VideoID, result.Error, result.Output)
+	}
+
+	// Report back even while shutting down
+	reportCtx, reportCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer reportCancel()
+	b, _ := json.Marshal(result)
+	resp, err := w.request(
+		reportCtx, http.MethodPost, fmt.Sprintf("/api/workers/jobs/%d/finish", lease.JobID),
+		bytes.NewReader(b), int64(len(b)),
+	)
+	if err != nil {
+		log.Printf("[env/remote] Cannot Report Outcome (ID: %s): %s\n", lease.VideoID, err)
+		return
+	}
+	resp.Body.Close()
+	if result.Error == "" && !result.Interrupted {
+		log.Printf("[env/remote] Video Processed: %s\n", lease.VideoID)
+	}
+}
+
+// Download the Original, run the Encoding Pipeline and Upload the Outputs
+func (w *remoteWorker) encode(
+	ctx context.Context,
+	lease WorkerLease,
+	inputFilepath, outputDirectory string,
+	progress func(percent string),
+) (result WorkerResult) {
+
+	// Step 1. Download Original
+	if err := w.download(ctx, lease.JobID, inputFilepath); err != nil {
+		var e *remoteError
+		result.Error = "Cannot Read Original Video"
+		result.Output = err.Error()
+		result.Transient = !errors.As(err, &e) || e.Status != http.StatusNotFound
+		return
+	}
+	if err := os.MkdirAll(outputDirectory, FILE_MODE); err != nil {
+		result.Error = "Cannot Create Output Directory"
+		result.Output = err.Error()
+		result.Transient = true
+		return
+	}
+
+	// Step 2. Encode Video
+	result.Duration, result.VideoOutputs, result.Error, result.Output = encodePipeline(ctx, lease.Profile, lease.Trim, lease.Audio, inputFilepath, outputDirectory, progress)
+	if result.Error != "" {
+		return
+	}
+
+	// Step 3. Upload Outputs
+	entries, err := os.ReadDir(outputDirectory)
+	if err == nil {
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			if err = w.upload(ctx, lease.JobID, e.Name(), path.Join(outputDirectory, e.Name())); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		result.Error = "Cannot Store Outputs"
+		result.Output = err.Error()
+		result.Transient = true
+		return
+	}
+	return
+}
+
+// Renew the Lease and Report Progress until ctx is done, cancelling it if the lease was lost
+// - Progress is sent at most once a second, otherwise the lease is renewed well before it expires
+func (w *remoteWorker) renew(ctx context.Context, cancel context.CancelFunc, lease WorkerLease, progress *atomic.Value) {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	var (
+		sentPercent string
+		sentAt      = time.Now()
+		interval    = time.Duration(lease.Lease) * time.Second / 3
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		percent, _ := progress.Load().(string)
+		if percent == sentPercent && time.Since(sentAt) < interval {
+			continue
+		}
+		b, _ := json.Marshal(map[string]string{"percent": percent})
+		resp, err := w.request(
+			ctx, http.MethodPost, fmt.Sprintf("/api/workers/jobs/%d/progress", lease.JobID),
+			bytes.NewReader(b), int64(len(b)),
+		)
+		if errors.Is(err, errLeaseLost) {
+			cancel()
+			return
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[env/remote] Cannot Renew Lease (ID: %s): %s\n", lease.VideoID, err)
+			}
+			continue
+		}
+		resp.Body.Close()
+		sentPercent, sentAt = percent, time.Now()
+	}
+}
+
+// Download the Original of a Leased Video to a Local File
+func (w *remoteWorker) download(ctx context.Context, jobID int64, localPath string) error {
+	resp, err := w.request(ctx, http.MethodGet, fmt.Sprintf("/api/workers/jobs/%d/original", jobID), nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	f, err := os.OpenFile(localPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, FILE_MODE)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Upload a Local File as an Output of a Leased Video
+func (w *remoteWorker) upload(ctx context.Context, jobID int64, filename, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	resp, err := w.request(
+		ctx, http.MethodPut, fmt.Sprintf("/api/workers/jobs/%d/files/%s", jobID, url.PathEscape(filename)),
+		f, s.Size(),
+	)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Send an Authenticated Request to the Server
+// - Returns errLeaseLost if the server no longer considers the video ours, or a remoteError for other failures
+func (w *remoteWorker) request(ctx context.Context, method, endpoint string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, w.server+endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	req.Header.Set("Authorization", "Bearer "+WORKER_SECRET)
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return nil, errLeaseLost
+	}
+	var message string
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if json.Unmarshal(b, &message) != nil {
+		message = string(b)
+	}
+	return nil, &remoteError{Status: resp.StatusCode, Message: message}
+}
@@ -0,0 +1,192 @@
+package env
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	RETENTION_DAYS           = EnvNumber("RETENTION_DAYS", 0)           // Retention: Delete videos after this many days, 0 to keep forever
+	RETENTION_ORIGINALS_DAYS = EnvNumber("RETENTION_ORIGINALS_DAYS", 0) // Retention: Delete originals of processed videos after this many days, 0 to keep forever
+	RETENTION_INTERVAL       = EnvNumber("RETENTION_INTERVAL", 3600)    // Retention: Seconds between each cleanup
+	RETENTION_UPLOADS_HOURS  = EnvNumber("RETENTION_UPLOADS_HOURS", 24) // Retention: Delete incomplete uploads after this many hours without a chunk, 0 to keep forever
+	retentionStart           sync.Once
+)
+
+func StartRetention(stop context.Context, await *sync.WaitGroup) {
+	retentionStart.Do(func() {
+		log.Printf(
+			"[env/retention] Videos kept for %d days, originals kept for %d days (0 is forever)\n",
+			RETENTION_DAYS, RETENTION_ORIGINALS_DAYS,
+		)
+		await.Add(1)
+		go func() {
+			defer await.Done()
+			t := time.NewTicker(time.Duration(RETENTION_INTERVAL) * time.Second)
+			defer t.Stop()
+			for {
+				if err := expireVideos(); err != nil {
+					log.Println("[env/retention] Cannot Expire Videos:", err)
+				}
+				if err := pruneOriginals(); err != nil {
+					log.Println("[env/retention] Cannot Prune Originals:", err)
+				}
+				if err := expireUploads(); err != nil {
+					log.Println("[env/retention] Cannot Expire Uploads:", err)
+				}
+				if err := pruneUploadHistory(); err != nil {
+					log.Println("[env/retention] Cannot Prune Upload History:", err)
+				}
+				select {
+				case <-stop.Done():
+					log.Println("[env/retention] Cleaned up Retention")
+					return
+				case <-t.C:
+				}
+			}
+		}()
+	})
+}
+
+// SQL Expression for when a Video will be Deleted, NULL if it is kept forever
+func SQLExpires() string {
+	if RETENTION_DAYS <= 0 {
+		return "expires"
+	}
+	return fmt.Sprintf("COALESCE(expires, datetime(created, '+%d days'))", RETENTION_DAYS)
+}
+
+// Delete Videos past their Expiry Date
+func expireVideos() error {
+	videoIDs, err := queryIDs(
+		`SELECT id FROM videos WHERE
+			(expires IS NOT NULL AND expires <= CURRENT_TIMESTAMP) OR
+			(expires IS NULL AND $1 > 0 AND created <= datetime('now', '-' || $1 || ' days'))`,
+		RETENTION_DAYS,
+	)
+	if err != nil {
+		return err
+	}
+	for _, videoID := range videoIDs {
+		if err := DeleteVideo(videoID); err != nil {
+			log.Printf("[env/retention] Cannot Delete Video %s: %s\n", videoID, err)
+			continue
+		}
+		log.Printf("[env/retention] Deleted expired video %s\n", videoID)
+	}
+	return nil
+}
+
+// Delete Originals of Processed Videos while keeping their Outputs
+func pruneOriginals() error {
+	if RETENTION_ORIGINALS_DAYS <= 0 {
+		return nil
+	}
+	videoIDs, err := queryIDs(
+		`SELECT id FROM videos WHERE
+			status = 'FINISH' AND original = 1 AND created <= datetime('now', '-' || $1 || ' days')`,
+		RETENTION_ORIGINALS_DAYS,
+	)
+	if err != nil {
+		return err
+	}
+	for _, videoID := range videoIDs {
+		if err := Storage.Delete("video/" + videoID); err != nil {
+			log.Printf("[env/retention] Cannot Delete Original %s: %s\n", videoID, err)
+			continue
+		}
+		var userID string
+		if err := DB.
+			QueryRow("UPDATE videos SET original = 0 WHERE id = $1 RETURNING user_id", videoID).
+			Scan(&userID); err != nil {
+			log.Printf("[env/retention] Cannot Update Video %s: %s\n", videoID, err)
+			continue
+		}
+		log.Printf("[env/retention] Deleted original of video %s\n", videoID)
+		SendEvent(userID, "VIDEO_ORIGINAL_PRUNED", videoID, "")
+	}
+	return nil
+}
+
+// Delete Incomplete Uploads that stopped receiving chunks, along with any partial file left without an upload
+// and the original of any upload that was stored but never queued
+func expireUploads() error {
+	if RETENTION_UPLOADS_HOURS <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(path.Join(DATA_DIR, "video"))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		uploadID, ok := strings.CutSuffix(e.Name(), ".part")
+		if !ok {
+			continue
+		}
+		if i, err := e.Info(); err != nil || time.Since(i.ModTime()) < time.Duration(RETENTION_UPLOADS_HOURS)*time.Hour {
+			continue
+		}
+		if _, err := DB.Exec("DELETE FROM uploads WHERE id = $1", uploadID); err != nil {
+			log.Printf("[env/retention] Cannot Delete Upload %s: %s\n", uploadID, err)
+			continue
+		}
+		if err := os.Remove(path.Join(DATA_DIR, "video", e.Name())); err != nil {
+			log.Printf("[env/retention] Cannot Delete Partial %s: %s\n", uploadID, err)
+			continue
+		}
+		log.Printf("[env/retention] Deleted abandoned upload %s\n", uploadID)
+	}
+
+	// Uploads that failed to be queued have already moved their original into storage
+	uploadIDs, err := queryIDs("SELECT id FROM uploads")
+	if err != nil {
+		return err
+	}
+	for _, uploadID := range uploadIDs {
+		if _, err := os.Stat(path.Join(DATA_DIR, "video", uploadID+".part")); err == nil {
+			continue
+		}
+		if m, err := Storage.Modified("video/" + uploadID); err != nil || time.Since(m) < time.Duration(RETENTION_UPLOADS_HOURS)*time.Hour {
+			continue
+		}
+		res, err := DB.Exec("DELETE FROM uploads WHERE id = $1", uploadID)
+		if err != nil {
+			log.Printf("[env/retention] Cannot Delete Upload %s: %s\n", uploadID, err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		if err := Storage.Delete("video/" + uploadID); err != nil {
+			log.Printf("[env/retention] Cannot Delete Original %s: %s\n", uploadID, err)
+			continue
+		}
+		log.Printf("[env/retention] Deleted unqueued upload %s\n", uploadID)
+	}
+	return nil
+}
+
+// Collect the IDs returned by a Query
+// - Rows are read in full before returning as the database only has a single connection
+func queryIDs(query string, args ...any) ([]string, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
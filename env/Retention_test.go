@@ -0,0 +1,77 @@
+package env
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpireUploads(t *testing.T) {
+	if _, err := DB.Exec("INSERT INTO users (id, name) VALUES ('uploadUser', 'Tester')"); err != nil {
+		t.Fatal(err)
+	}
+	for _, uploadID := range []string{"staleUpload", "freshUpload"} {
+		if _, err := DB.Exec("INSERT INTO uploads (id, user_id, filename, size) VALUES ($1, 'uploadUser', 'clip.mp4', 100)", uploadID); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(DATA_DIR, "video", uploadID+".part"), []byte("partial"), FILE_MODE); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			DB.Exec("DELETE FROM uploads WHERE id = $1", uploadID)
+			os.Remove(path.Join(DATA_DIR, "video", uploadID+".part"))
+		})
+	}
+	stale := time.Now().Add(-time.Duration(RETENTION_UPLOADS_HOURS+1) * time.Hour)
+	if err := os.Chtimes(path.Join(DATA_DIR, "video", "staleUpload.part"), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := expireUploads(); err != nil {
+		t.Fatal(err)
+	}
+
+	for uploadID, kept := range map[string]bool{"staleUpload": false, "freshUpload": true} {
+		var rows int
+		DB.QueryRow("SELECT COUNT(*) FROM uploads WHERE id = $1", uploadID).Scan(&rows)
+		_, err := os.Stat(path.Join(DATA_DIR, "video", uploadID+".part"))
+		if (rows == 1) != kept || (err == nil) != kept {
+			t.Errorf("Upload %s has %d rows and partial error %v, expected kept to be %t", uploadID, rows, err, kept)
+		}
+	}
+}
+
+func TestExpireUnqueuedUploads(t *testing.T) {
+	if _, err := DB.Exec("INSERT INTO users (id, name) VALUES ('unqueuedUser', 'Tester')"); err != nil {
+		t.Fatal(err)
+	}
+	for _, uploadID := range []string{"staleStored", "freshStored"} {
+		if _, err := DB.Exec("INSERT INTO uploads (id, user_id, filename, size, received) VALUES ($1, 'unqueuedUser', 'clip.mp4', 8, 8)", uploadID); err != nil {
+			t.Fatal(err)
+		}
+		if err := Storage.Put("video/"+uploadID, strings.NewReader("original"), 8); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			DB.Exec("DELETE FROM uploads WHERE id = $1", uploadID)
+			Storage.Delete("video/" + uploadID)
+		})
+	}
+	stale := time.Now().Add(-time.Duration(RETENTION_UPLOADS_HOURS+1) * time.Hour)
+	if err := os.Chtimes(path.Join(DATA_DIR, "video", "staleStored"), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := expireUploads(); err != nil {
+		t.Fatal(err)
+	}
+
+	for uploadID, kept := range map[string]bool{"staleStored": false, "freshStored": true} {
+		var rows int
+		DB.QueryRow("SELECT COUNT(*) FROM uploads WHERE id = $1", uploadID).Scan(&rows)
+		_, err := Storage.Stat("video/" + uploadID)
+		if (rows == 1) != kept || (err == nil) != kept {
+			t.Errorf("Upload %s has %d rows and original error %v, expected kept to be %t", uploadID, rows, err, kept)
+		}
+	}
+}
@@ -1,5 +1,6 @@
 -- All changes to this schema file should be incremental
 -- as the program will execute this query on startup!
+-- Each "-- Version" section is only applied once per database.
 
 -- Version 1.0 - Initial Release
 PRAGMA foreign_keys = ON;
@@ -18,4 +19,146 @@ CREATE TABLE IF NOT EXISTS videos (
     user_id             TEXT        NOT NULL,                           -- Relevant User ID
     status              TEXT        NOT NULL CHECK(status IN ('QUEUE', 'PROCESS', 'ERROR', 'FINISH')),
     FOREIGN KEY (user_id) REFERENCES users(id)
-);
\ No newline at end of file
+);
+
+-- Version 1.1 - Resumable Uploads
+CREATE TABLE IF NOT EXISTS uploads (
+    id                  TEXT        NOT NULL UNIQUE,                    -- Upload ID, becomes the Video ID once finalized
+    created             TEXT        NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Created At
+    user_id             TEXT        NOT NULL,                           -- Relevant User ID
+    filename            TEXT        NOT NULL,                           -- Original Filename
+    size                INTEGER     NOT NULL,                           -- Expected Size in Bytes
+    received            INTEGER     NOT NULL DEFAULT 0,                 -- Bytes Written to Disk so far
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+
+-- Version 1.2 - Video Metadata
+ALTER TABLE videos ADD COLUMN title         TEXT NOT NULL DEFAULT '';   -- Video Title, defaults to the uploaded filename
+ALTER TABLE videos ADD COLUMN description   TEXT NOT NULL DEFAULT '';   -- Video Description
+
+-- Version 1.3 - Adaptive Streaming
+ALTER TABLE videos ADD COLUMN hls           INTEGER NOT NULL DEFAULT 0; -- Was an HLS Playlist Generated?
+
+-- Version 1.4 - Quotas
+ALTER TABLE users ADD COLUMN quota_storage  INTEGER;                    -- Storage Limit in Bytes, NULL uses the default
+ALTER TABLE users ADD COLUMN quota_videos   INTEGER;                    -- Video Limit, NULL uses the default
+ALTER TABLE users ADD COLUMN quota_daily    INTEGER;                    -- Daily Upload Limit, NULL uses the default
+ALTER TABLE videos ADD COLUMN size          INTEGER NOT NULL DEFAULT 0; -- Size of the Original in Bytes
+
+-- Version 1.5 - Moderation
+ALTER TABLE users ADD COLUMN banned         TEXT;                       -- Ban Reason, NULL if not banned
+
+-- Version 1.6 - Reports
+ALTER TABLE videos ADD COLUMN moderation    TEXT NOT NULL DEFAULT 'NONE' CHECK(moderation IN ('NONE', 'REVIEW', 'REMOVED')); -- Moderation State
+CREATE TABLE IF NOT EXISTS reports (
+    id                  INTEGER     PRIMARY KEY AUTOINCREMENT,          -- Report ID
+    created             TEXT        NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Report Creation Date
+    video_id            TEXT        NOT NULL,                           -- Reported Video
+    user_id             TEXT,                                           -- Reporter's User ID, NULL if anonymous
+    ip                  TEXT        NOT NULL,                           -- Reporter's IP Address
+    reason              TEXT        NOT NULL,                           -- Report Category
+    details             TEXT        NOT NULL DEFAULT '',                -- Optional Details from the Reporter
+    resolved            INTEGER     NOT NULL DEFAULT 0,                 -- Has an Administrator handled this report?
+    FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS reports_video ON reports (video_id);
+
+-- Version 1.7 - Visibility
+ALTER TABLE videos ADD COLUMN visibility    TEXT NOT NULL DEFAULT 'PUBLIC' CHECK(visibility IN ('PUBLIC', 'UNLISTED', 'PRIVATE')); -- Who can view the Video
+
+-- Version 1.8 - Share Links
+ALTER TABLE videos ADD COLUMN share_key     TEXT NOT NULL DEFAULT '';   -- Mixed into Share Link Signatures, rotated to revoke them
+CREATE TABLE IF NOT EXISTS shares (
+    id                  TEXT        NOT NULL UNIQUE,                    -- Share ID
+    created             TEXT        NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Created At
+    video_id            TEXT        NOT NULL,                           -- Shared Video
+    max_views           INTEGER     NOT NULL,                           -- Amount of Views Allowed
+    views               INTEGER     NOT NULL DEFAULT 0,                 -- Amount of Views so far
+    FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+-- Version 1.9 - Retention
+ALTER TABLE videos ADD COLUMN expires       TEXT;                       -- Deletion Date, NULL uses the default retention period
+ALTER TABLE videos ADD COLUMN original      INTEGER NOT NULL DEFAULT 1; -- Is the Original still in Storage?
+
+-- Version 1.10 - Retries
+ALTER TABLE videos ADD COLUMN attempts      INTEGER NOT NULL DEFAULT 0; -- Failed Encoding Attempts since the last Success
+ALTER TABLE videos ADD COLUMN retry_after   TEXT;                       -- Earliest Time to Retry Encoding, NULL if immediately
+
+-- Version 1.11 - Encoding History
+CREATE TABLE IF NOT EXISTS encode_jobs (
+    id                  INTEGER     PRIMARY KEY AUTOINCREMENT,          -- Attempt ID
+    video_id            TEXT        NOT NULL,                           -- Relevant Video ID
+    worker              TEXT        NOT NULL,                           -- Worker that made the Attempt
+    codec               TEXT        NOT NULL,                           -- Video Codec used
+    status              TEXT        NOT NULL CHECK(status IN ('PROCESS', 'FINISH', 'ERROR', 'CANCEL')),
+    started             TEXT        NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Started At
+    finished            TEXT,                                           -- Finished At, NULL if still running
+    error               TEXT,                                           -- Error Message shown to the User
+    output              TEXT,                                           -- Trimmed FFmpeg Output
+    FOREIGN KEY (video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS encode_jobs_video ON encode_jobs (video_id);
+
+-- Version 1.12 - Job Queue
+ALTER TABLE videos ADD COLUMN duration      REAL;                       -- Duration of the Original in Seconds, NULL if unknown
+CREATE INDEX IF NOT EXISTS videos_status ON videos (status);
+
+-- Version 1.13 - Remote Workers
+ALTER TABLE encode_jobs ADD COLUMN lease_expires TEXT;                  -- Remote Workers lose the Video after this, NULL for local Encoders
+
+-- Version 1.14 - Encoding Profiles
+ALTER TABLE videos ADD COLUMN profile       TEXT NOT NULL DEFAULT 'default'; -- Encoding Profile Name
+ALTER TABLE uploads ADD COLUMN profile      TEXT NOT NULL DEFAULT 'default'; -- Encoding Profile chosen for the Video
+
+-- Version 1.15 - Storyboards
+ALTER TABLE videos ADD COLUMN storyboard    INTEGER NOT NULL DEFAULT 0; -- Was a Sprite Sheet Generated for Seek Previews?
+
+-- Version 1.16 - Animated Previews
+ALTER TABLE videos ADD COLUMN animated      INTEGER NOT NULL DEFAULT 0; -- Was an Animated Preview Generated for Embeds?
+
+-- Version 1.17 - Trimming
+ALTER TABLE videos ADD COLUMN trim_start    REAL NOT NULL DEFAULT 0; -- Seconds into the Original to start Encoding from
+ALTER TABLE videos ADD COLUMN trim_end      REAL NOT NULL DEFAULT 0; -- Seconds into the Original to stop Encoding at, 0 is the end
+ALTER TABLE uploads ADD COLUMN trim_start   REAL NOT NULL DEFAULT 0; -- Trim chosen for the Video
+ALTER TABLE uploads ADD COLUMN trim_end     REAL NOT NULL DEFAULT 0; -- Trim chosen for the Video
+
+-- Version 1.18 - Audio Tracks
+ALTER TABLE videos ADD COLUMN audio         TEXT NOT NULL DEFAULT '{}'; -- Audio Tracks chosen for the Video as JSON
+ALTER TABLE uploads ADD COLUMN audio        TEXT NOT NULL DEFAULT '{}'; -- Audio Tracks chosen for the Video as JSON
+
+-- Version 1.19 - Share Viewers
+CREATE TABLE IF NOT EXISTS share_viewers (
+    share_id            TEXT        NOT NULL,                           -- Share Link
+    viewer              TEXT        NOT NULL,                           -- Viewer ID from their Cookie
+    created             TEXT        NOT NULL DEFAULT CURRENT_TIMESTAMP, -- First Viewed At
+    PRIMARY KEY (share_id, viewer),
+    FOREIGN KEY (share_id) REFERENCES shares(id) ON DELETE CASCADE
+);
+
+-- Version 1.20 - Published Outputs
+ALTER TABLE videos ADD COLUMN published     INTEGER NOT NULL DEFAULT 0; -- Are Outputs from a Finished Encode being Served? Kept while Re-encoding
+UPDATE videos SET published = 1 WHERE status = 'FINISH';
+
+-- Version 1.21 - Upload History
+CREATE TABLE IF NOT EXISTS upload_history (
+    user_id             TEXT        NOT NULL,                           -- Uploader, rows are kept when their video is deleted
+    created             TEXT        NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Uploaded At
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS upload_history_user ON upload_history (user_id, created);
+INSERT INTO upload_history (user_id, created) SELECT user_id, created FROM videos WHERE created > datetime('now', '-1 day');
+
+-- Version 1.22 - Output Revisions
+ALTER TABLE videos ADD COLUMN revision      TEXT NOT NULL DEFAULT ''; -- Outputs being Served are under "public/<id>/<revision>", empty for "public/<id>"
+
+-- Version 1.23 - Hidden Videos
+ALTER TABLE videos RENAME COLUMN moderation TO moderation_old;
+ALTER TABLE videos ADD COLUMN moderation    TEXT NOT NULL DEFAULT 'NONE' CHECK(moderation IN ('NONE', 'REVIEW', 'HIDDEN', 'REMOVED')); -- Moderation State, HIDDEN after enough Reports until Reviewed
+UPDATE videos SET moderation = moderation_old;
+ALTER TABLE videos DROP COLUMN moderation_old;
+
+-- Version 1.24 - Untrimmed Durations
+ALTER TABLE videos ADD COLUMN original_duration REAL;                   -- Duration of the Original before Trimming in Seconds, NULL if unknown
+UPDATE videos SET original_duration = duration WHERE trim_start = 0 AND trim_end = 0;
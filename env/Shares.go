@@ -0,0 +1,133 @@
+package env
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	SHARE_SECRET       []byte                                                                  // Share Links: Signing Secret
+	SHARE_MAX_LIFETIME = time.Duration(EnvNumber("SHARE_MAX_LIFETIME", 2592000)) * time.Second // Share Links: Longest Allowed Lifetime
+)
+
+// Load the Share Secret
+func setupShareSecret() {
+	// Use the Configured Secret, otherwise Generate one that persists across restarts
+	if s := os.Getenv("SHARE_SECRET"); s != "" {
+		SHARE_SECRET = []byte(s)
+		return
+	}
+	p := path.Join(DATA_DIR, "share.key")
+	b, err := os.ReadFile(p)
+	if err == nil {
+		SHARE_SECRET = b
+		return
+	}
+	if !os.IsNotExist(err) {
+		log.Fatalln("[env/shares] Cannot Read Secret:", err)
+	}
+	b = make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalln("[env/shares] Cannot Generate Secret:", err)
+	}
+	b = []byte(hex.EncodeToString(b))
+	if err := os.WriteFile(p, b, FILE_MODE); err != nil {
+		log.Fatalln("[env/shares] Cannot Write Secret:", err)
+	}
+	SHARE_SECRET = b
+	log.Println("[env/shares] Generated new secret at", p)
+}
+
+// Create a Share Token for a Video
+// - shareID is the ID of a row in the shares table for links with a view limit, otherwise empty
+func SignShare(videoID, shareKey, shareID string, expires time.Time) string {
+	e := strconv.FormatInt(expires.Unix(), 10)
+	return e + "." + shareID + "." + shareSignature(videoID, shareKey, shareID, e)
+}
+
+// Check if a Share Token grants access to a Video
+// - Links with a view limit remember each viewer, who keep their access once they have used up a view
+// - Setting consume uses up a view for a new viewer, otherwise new viewers are only let in while views remain
+func CheckShare(videoID, token, viewerID string, consume bool) (bool, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false, nil
+	}
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false, nil
+	}
+
+	// Verify Signature
+	var shareKey string
+	err = DB.QueryRow("SELECT share_key FROM videos WHERE id = $1", videoID).Scan(&shareKey)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(shareSignature(videoID, shareKey, parts[1], parts[0]))) {
+		return false, nil
+	}
+	if parts[1] == "" {
+		return true, nil
+	}
+
+	// Enforce View Limit
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var found int
+	err = tx.
+		QueryRow(
+			`SELECT 1 FROM share_viewers v JOIN shares s ON s.id = v.share_id
+			WHERE v.share_id = $1 AND s.video_id = $2 AND v.viewer = $3`,
+			parts[1], videoID, viewerID,
+		).
+		Scan(&found)
+	if err == nil {
+		return true, nil
+	}
+	if err != sql.ErrNoRows {
+		return false, err
+	}
+	if !consume {
+		err = tx.QueryRow("SELECT 1 FROM shares WHERE id = $1 AND video_id = $2 AND views < max_views", parts[1], videoID).Scan(&found)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	err = tx.
+		QueryRow("UPDATE shares SET views = views + 1 WHERE id = $1 AND video_id = $2 AND views < max_views RETURNING 1", parts[1], videoID).
+		Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("INSERT INTO share_viewers (share_id, viewer) VALUES ($1, $2)", parts[1], viewerID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func shareSignature(videoID, shareKey, shareID, expires string) string {
+	h := hmac.New(sha256.New, SHARE_SECRET)
+	h.Write([]byte(videoID + "\n" + shareKey + "\n" + shareID + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
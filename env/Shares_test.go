@@ -0,0 +1,42 @@
+package env
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShareViewLimit(t *testing.T) {
+	videoID, _ := queueTestVideo(t, "default")
+	if _, err := DB.Exec("INSERT INTO shares (id, video_id, max_views) VALUES ('testShare01', $1, 1)", videoID); err != nil {
+		t.Fatal(err)
+	}
+	token := SignShare(videoID, "", "testShare01", time.Now().Add(time.Hour))
+
+	// The first viewer keeps their access after using up the only view, everyone else is turned away
+	steps := []struct {
+		viewer  string
+		consume bool
+		allowed bool
+	}{
+		{"first", false, true},
+		{"first", true, true},
+		{"first", true, true},
+		{"first", false, true},
+		{"second", false, false},
+		{"second", true, false},
+	}
+	for i, s := range steps {
+		allowed, err := CheckShare(videoID, token, s.viewer, s.consume)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != s.allowed {
+			t.Errorf("Step %d: %s viewer (consume %t) was allowed %t, expected %t", i, s.viewer, s.consume, allowed, s.allowed)
+		}
+	}
+	var views int
+	DB.QueryRow("SELECT views FROM shares WHERE id = 'testShare01'").Scan(&views)
+	if views != 1 {
+		t.Errorf("Counted %d views, expected 1", views)
+	}
+}
@@ -0,0 +1,261 @@
+package env
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A Place to Store Originals and Public Outputs
+// Keys are slash delimited paths such as "video/<id>" or "public/<id>/video.mp4"
+type StorageBackend interface {
+	// Create or Replace an Object
+	Put(key string, r io.Reader, size int64) error
+	// Read an Object, returns fs.ErrNotExist if missing
+	Get(key string) (io.ReadCloser, error)
+	// Delete an Object and everything nested under it
+	Delete(key string) error
+	// Fetch the Size of an Object, returns fs.ErrNotExist if missing
+	Stat(key string) (int64, error)
+	// Fetch when an Object was last Written, returns fs.ErrNotExist if missing
+	Modified(key string) (time.Time, error)
+	// A URL clients can be redirected to for the Object, or an empty string if it should be served by us
+	URL(key string) string
+	// List the Keys of all Objects starting with the given Prefix
+	List(prefix string) ([]string, error)
+}
+
+var (
+	STORAGE_BACKEND = EnvString("STORAGE_BACKEND", "disk") // Storage: Either "disk" or "s3"
+	Storage         StorageBackend
+)
+
+// Connect to the Configured Storage Backend
+func setupStorage() {
+	switch STORAGE_BACKEND {
+	case "disk":
+		Storage = &diskStorage{root: DATA_DIR}
+	case "s3":
+		s := &s3Storage{
+			endpoint:  strings.TrimSuffix(EnvString("S3_ENDPOINT", ""), "/"),
+			region:    EnvString("S3_REGION", "us-east-1"),
+			bucket:    EnvString("S3_BUCKET", ""),
+			accessKey: EnvString("S3_ACCESS_KEY", ""),
+			secretKey: EnvString("S3_SECRET_KEY", ""),
+			publicURL: strings.TrimSuffix(os.Getenv("S3_PUBLIC_URL"), "/"),
+		}
+		if err := s.ping(); err != nil {
+			log.Fatalln("[env/storage] Cannot Reach Bucket:", err)
+		}
+		Storage = s
+	default:
+		log.Fatalln("[env/storage] Unknown Storage Backend:", STORAGE_BACKEND)
+	}
+	log.Println("[env/storage] Using storage backend:", STORAGE_BACKEND)
+}
+
+// Make an Object available as a Local File for Reading
+// The cleanup function must be called once finished with the file
+func StorageFetch(key string) (string, func(), error) {
+	if d, ok := Storage.(*diskStorage); ok {
+		return d.path(key), func() {}, nil
+	}
+	r, err := Storage.Get(key)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+	f, err := os.CreateTemp(path.Join(DATA_DIR, "temp"), "fetch-*")
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	cleanup := func() { os.Remove(f.Name()) }
+	if _, err := io.Copy(f, r); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return f.Name(), cleanup, nil
+}
+
+// Move a Local File into Storage
+func StoragePutFile(key, localPath string) error {
+	if d, ok := Storage.(*diskStorage); ok {
+		return d.move(key, localPath)
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := Storage.Put(key, f, s.Size()); err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(localPath)
+}
+
+// Move a Local Directory into Storage, replacing anything already stored under the key
+func StoragePutDir(key, localDirectory string) error {
+	if d, ok := Storage.(*diskStorage); ok {
+		if err := os.RemoveAll(d.path(key)); err != nil {
+			return err
+		}
+		return d.move(key, localDirectory)
+	}
+	if err := Storage.Delete(key); err != nil {
+		return err
+	}
+	err := filepath.WalkDir(localDirectory, func(p string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(localDirectory, p)
+		if err != nil {
+			return err
+		}
+		return StoragePutFile(path.Join(key, filepath.ToSlash(rel)), p)
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(localDirectory)
+}
+
+// Move everything under a Key to another, replacing anything already stored under it
+func StorageMove(from, to string) error {
+	if d, ok := Storage.(*diskStorage); ok {
+		if err := os.RemoveAll(d.path(to)); err != nil {
+			return err
+		}
+		return d.move(to, d.path(from))
+	}
+	if err := Storage.Delete(to); err != nil {
+		return err
+	}
+	keys, err := Storage.List(from + "/")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		size, err := Storage.Stat(key)
+		if err != nil {
+			return err
+		}
+		r, err := Storage.Get(key)
+		if err != nil {
+			return err
+		}
+		err = Storage.Put(to+strings.TrimPrefix(key, from), r, size)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return Storage.Delete(from)
+}
+
+// Stores Objects in the Data Directory
+type diskStorage struct {
+	root string
+}
+
+func (d *diskStorage) path(key string) string {
+	return filepath.Join(d.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (d *diskStorage) move(key, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(d.path(key)), FILE_MODE); err != nil {
+		return err
+	}
+	return os.Rename(localPath, d.path(key))
+}
+
+func (d *diskStorage) Put(key string, r io.Reader, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(d.path(key)), FILE_MODE); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(d.path(key), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, FILE_MODE)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (d *diskStorage) Get(key string) (io.ReadCloser, error) {
+	f, err := os.Open(d.path(key))
+	if err != nil {
+		return nil, err
+	}
+	if s, err := f.Stat(); err != nil || s.IsDir() {
+		f.Close()
+		return nil, fs.ErrNotExist
+	}
+	return f, nil
+}
+
+func (d *diskStorage) Delete(key string) error {
+	return os.RemoveAll(d.path(key))
+}
+
+func (d *diskStorage) Stat(key string) (int64, error) {
+	s, err := os.Stat(d.path(key))
+	if err != nil {
+		return 0, err
+	}
+	if s.IsDir() {
+		return 0, fs.ErrNotExist
+	}
+	return s.Size(), nil
+}
+
+func (d *diskStorage) Modified(key string) (time.Time, error) {
+	s, err := os.Stat(d.path(key))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if s.IsDir() {
+		return time.Time{}, fs.ErrNotExist
+	}
+	return s.ModTime(), nil
+}
+
+func (d *diskStorage) URL(key string) string {
+	return ""
+}
+
+func (d *diskStorage) List(prefix string) ([]string, error) {
+	keys := []string{}
+	root := d.path(path.Dir(prefix + "_"))
+	err := filepath.WalkDir(root, func(p string, e fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || e.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(d.root, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
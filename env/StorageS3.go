@@ -0,0 +1,310 @@
+package env
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3PresignLifetime = time.Hour          // How long Redirect URLs are valid for
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD" // Skip hashing of request bodies
+)
+
+// Stores Objects in an S3 Compatible Bucket using path-style requests
+// - MinIO and most other providers will work with this
+type s3Storage struct {
+	endpoint  string // e.g. "http://localhost:9000"
+	region    string // e.g. "us-east-1"
+	bucket    string // Bucket Name
+	accessKey string // Access Key ID
+	secretKey string // Secret Access Key
+	publicURL string // Optional: Public Base URL for Objects, otherwise presigned URLs are used
+}
+
+// Ensure the Bucket Exists and our Credentials Work
+func (s *s3Storage) ping() error {
+	resp, err := s.do(http.MethodHead, "", nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server responded with %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *s3Storage) Put(key string, r io.Reader, size int64) error {
+	resp, err := s.do(http.MethodPut, key, nil, r, size)
+	if err != nil {
+		return err
+	}
+	return s.check(resp)
+}
+
+func (s *s3Storage) Get(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s.check(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *s3Storage) Delete(key string) error {
+	// Delete Nested Objects
+	keys, err := s.List(key + "/")
+	if err != nil {
+		return err
+	}
+	for _, k := range append(keys, key) {
+		resp, err := s.do(http.MethodDelete, k, nil, nil, 0)
+		if err != nil {
+			return err
+		}
+		if err := s.check(resp); err != nil && err != fs.ErrNotExist {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *s3Storage) Stat(key string) (int64, error) {
+	resp, err := s.do(http.MethodHead, key, nil, nil, 0)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.check(resp); err != nil {
+		return 0, err
+	}
+	return resp.ContentLength, nil
+}
+
+func (s *s3Storage) Modified(key string) (time.Time, error) {
+	resp, err := s.do(http.MethodHead, key, nil, nil, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := s.check(resp); err != nil {
+		return time.Time{}, err
+	}
+	return http.ParseTime(resp.Header.Get("Last-Modified"))
+}
+
+func (s *s3Storage) URL(key string) string {
+	if s.publicURL != "" {
+		return s.publicURL + "/" + s3Escape(key, false)
+	}
+
+	// Generate Presigned URL
+	t := time.Now().UTC()
+	u := s.objectURL(key)
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(t))
+	q.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(s3PresignLifetime.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	u.RawQuery = s3Query(q)
+	signature := s.sign(t, http.MethodGet, u, http.Header{"Host": {u.Host}}, s3UnsignedPayload)
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String()
+}
+
+func (s *s3Storage) List(prefix string) ([]string, error) {
+	var (
+		keys  []string
+		token string
+	)
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", q, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, s.check(resp)
+		}
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !result.IsTruncated {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Consume a Response and Convert its Status into an Error
+func (s *s3Storage) check(resp *http.Response) error {
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fs.ErrNotExist
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	default:
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3 responded with %s (%s)", resp.Status, strings.TrimSpace(string(b)))
+	}
+}
+
+// Send a Signed Request for an Object (or the Bucket if key is empty)
+func (s *s3Storage) do(method, key string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	t := time.Now().UTC()
+	u := s.objectURL(key)
+	u.RawQuery = s3Query(query)
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	req.Header.Set("Host", u.Host)
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey,
+		s.scope(t),
+		s3SignedHeaders(req.Header),
+		s.sign(t, method, u, req.Header, s3UnsignedPayload),
+	))
+	return http.DefaultClient.Do(req)
+}
+
+func (s *s3Storage) objectURL(key string) *url.URL {
+	u, _ := url.Parse(s.endpoint)
+	u.Path = "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = "/" + s3Escape(s.bucket, false)
+	if key != "" {
+		u.RawPath += "/" + s3Escape(key, false)
+	}
+	return u
+}
+
+func (s *s3Storage) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// Calculate an AWS Signature Version 4 for the Request
+func (s *s3Storage) sign(t time.Time, method string, u *url.URL, headers http.Header, payloadHash string) string {
+	canonicalHash := sha256.Sum256([]byte(s3CanonicalRequest(method, u, headers, payloadHash)))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format("20060102T150405Z"),
+		s.scope(t),
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+
+	key := s3HMAC([]byte("AWS4"+s.secretKey), t.Format("20060102"))
+	key = s3HMAC(key, s.region)
+	key = s3HMAC(key, "s3")
+	key = s3HMAC(key, "aws4_request")
+	return hex.EncodeToString(s3HMAC(key, stringToSign))
+}
+
+// Describe the Request in the Canonical Form that is Signed, every header given is signed
+func s3CanonicalRequest(method string, u *url.URL, headers http.Header, payloadHash string) string {
+	var canonicalHeaders strings.Builder
+	signedHeaders := s3SignedHeaders(headers)
+	for _, name := range strings.Split(signedHeaders, ";") {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers.Get(name)) + "\n")
+	}
+	return strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		u.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Lowercase and Sorted Header Names, delimited with a semicolon
+func s3SignedHeaders(headers http.Header) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ";")
+}
+
+// Encode Query Parameters in the Canonical Order
+func s3Query(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(query))
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// URI Encode a String as described by the AWS Signature Specification
+func s3Escape(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			sb.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,65 @@
+package env
+
+// Delete a Video and all of its Files, cancelling its encoding if in progress
+// - Returns sql.ErrNoRows if the video does not exist
+func DeleteVideo(videoID string) error {
+	var userID string
+	err := DB.
+		QueryRow("DELETE FROM videos WHERE id = $1 RETURNING user_id", videoID).
+		Scan(&userID)
+	if err != nil {
+		return err
+	}
+	CancelEncoder(videoID)
+	notifyQueue()
+	if err := Storage.Delete("public/" + videoID); err != nil {
+		return err
+	}
+	if err := Storage.Delete("pending/" + videoID); err != nil {
+		return err
+	}
+	if err := Storage.Delete("video/" + videoID); err != nil {
+		return err
+	}
+	SendEvent(userID, "VIDEO_DELETED", videoID, "")
+	return nil
+}
+
+// Queue Videos to be Encoded again from their Originals, empty filters match everything
+// - Only finished or failed videos that still have their original are queued
+// - Their previous outputs are served until the new encode finishes
+// - Returns the IDs of the videos that were queued
+func ReencodeVideos(videoID, userID, status string) ([]string, error) {
+	rows, err := DB.Query(
+		`UPDATE videos SET status = 'QUEUE', attempts = 0, retry_after = NULL
+		WHERE ($1 = '' OR id = $1) AND ($2 = '' OR user_id = $2) AND ($3 = '' OR status = $3)
+			AND status IN ('FINISH', 'ERROR') AND original = 1
+		RETURNING id, user_id`,
+		videoID, userID, status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	type queued struct{ videoID, userID string }
+	videos := []queued{}
+	for rows.Next() {
+		var v queued
+		if err := rows.Scan(&v.videoID, &v.userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		videos = append(videos, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	videoIDs := make([]string, 0, len(videos))
+	for _, v := range videos {
+		SendEvent(v.userID, "VIDEO_QUEUED", v.videoID, "")
+		WakeEncoder()
+		videoIDs = append(videoIDs, v.videoID)
+	}
+	return videoIDs, nil
+}
@@ -0,0 +1,175 @@
+package env
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+var (
+	WORKER_SECRET = os.Getenv("WORKER_SECRET")    // Workers: Shared Secret for Remote Workers, leave empty to disable them
+	WORKER_LEASE  = EnvNumber("WORKER_LEASE", 60) // Workers: Seconds a Remote Worker can go without checking in before its video is queued again
+)
+
+// A Video Leased to a Remote Worker
+type WorkerLease struct {
+	JobID   int64         `json:"job_id"`
+	VideoID string        `json:"video_id"`
+	Lease   int           `json:"lease"`   // Seconds until the Lease Expires unless Renewed
+	Profile EncodeProfile `json:"profile"` // Settings to Encode the Video with
+	Trim    VideoTrim     `json:"trim"`    // Section of the Original to Encode
+	Audio   VideoAudio    `json:"audio"`   // Audio Tracks to Encode
+}
+
+// Outcome of a Remote Worker Encoding a Video
+type WorkerResult struct {
+	VideoOutputs         // Optional Outputs that were Uploaded
+	Duration     float64 `json:"duration"`    // Length of the Video in Seconds, 0 if unknown
+	Error        string  `json:"error"`       // Error Message shown to the User, empty on success
+	Output       string  `json:"output"`      // FFmpeg Output explaining the Error
+	Transient    bool    `json:"transient"`   // Could retrying fix the Error?
+	Interrupted  bool    `json:"interrupted"` // Was the Worker shut down before it could finish?
+}
+
+// Lease the Next Video in the Queue to a Remote Worker
+// - Returns sql.ErrNoRows if there is nothing to do
+func LeaseVideo(worker, codec string) (WorkerLease, error) {
+	lease := WorkerLease{Lease: WORKER_LEASE}
+	videoID, _, userID, profile, trim, audio, err := claimVideo()
+	if err != nil {
+		return lease, err
+	}
+	lease.Profile = lookupProfile(profile)
+	lease.Trim = trim
+	lease.Audio = audio
+	err = DB.
+		QueryRow(
+			`INSERT INTO encode_jobs (video_id, worker, codec, status, lease_expires)
+			VALUES ($1, $2, $3, 'PROCESS', datetime('now', '+' || $4 || ' seconds')) RETURNING id`,
+			videoID, worker, codec, WORKER_LEASE,
+		).
+		Scan(&lease.JobID)
+	if err != nil {
+		requeueVideo(videoID)
+		return lease, err
+	}
+	lease.VideoID = videoID
+
+	// Outputs are uploaded one at a time so they are staged until the encode finishes
+	// Anything left from an earlier lease is removed first, previous outputs are still served
+	if err := Storage.Delete("pending/" + videoID); err != nil {
+		log.Printf("[env/workers] Cannot Remove Staged Outputs (ID: %s): %s\n", videoID, err)
+	}
+	SendEvent(userID, "VIDEO_PROCESSING_BEGIN", videoID, "")
+	notifyQueue()
+	return lease, nil
+}
+
+// Extend the Lease on a Video while its Worker is still working on it
+// - Returns sql.ErrNoRows if the lease expired or the video was deleted
+func RenewLease(jobID int64) (videoID, userID string, err error) {
+	err = DB.
+		QueryRow(
+			`UPDATE encode_jobs SET lease_expires = datetime('now', '+' || $1 || ' seconds')
+			WHERE id = $2 AND status = 'PROCESS' AND lease_expires > CURRENT_TIMESTAMP
+			RETURNING video_id`,
+			WORKER_LEASE, jobID,
+		).
+		Scan(&videoID)
+	if err != nil {
+		return
+	}
+	err = DB.QueryRow("SELECT user_id FROM videos WHERE id = $1", videoID).Scan(&userID)
+	return
+}
+
+// Record the Outcome of a Leased Video, whose outputs were already uploaded to "pending/<id>"
+// - Outputs are moved to a new revision and replace the previous ones only if the encode succeeded
+// - Returns sql.ErrNoRows if the lease expired or the video was deleted
+func FinishLease(jobID int64, result WorkerResult) error {
+	videoID, userID, err := RenewLease(jobID)
+	if err != nil {
+		return err
+	}
+	defer notifyQueue()
+	if result.Duration > 0 {
+		if _, err := DB.Exec("UPDATE videos SET duration = $1 WHERE id = $2", result.Duration, videoID); err != nil {
+			log.Printf("[env/workers] Cannot Store Duration (ID: %s): %s\n", videoID, err)
+		}
+	}
+	switch {
+	case result.Interrupted:
+		log.Printf("[env/workers] Encoding Interrupted (ID: %s)\n", videoID)
+		Storage.Delete("pending/" + videoID)
+		if err := finishEncodeJob(jobID, "CANCEL", "", ""); err != nil {
+			return err
+		}
+		return requeueVideo(videoID)
+
+	case result.Error != "":
+		log.Printf("[env/workers] Encoding Error (ID: %s): %s\nOutput: %s\n---\n", videoID, result.Error, result.Output)
+		Storage.Delete("pending/" + videoID)
+		if err := finishEncodeJob(jobID, "ERROR", result.Error, result.Output); err != nil {
+			return err
+		}
+		if delay, ok := failVideo(videoID, userID, result.Error, result.Transient); ok {
+			log.Printf("[env/workers] Retrying in %s (ID: %s)\n", delay, videoID)
+		}
+		return nil
+	}
+
+	var videoCreated string
+	if err := DB.QueryRow("SELECT created FROM videos WHERE id = $1", videoID).Scan(&videoCreated); err != nil {
+		return err
+	}
+	revision := newRevision()
+	if err := StorageMove("pending/"+videoID, OutputsKey(videoID, revision)); err != nil {
+		log.Printf("[env/workers] Cannot Store Outputs (ID: %s): %s\n", videoID, err)
+		Storage.Delete("pending/" + videoID)
+		Storage.Delete(OutputsKey(videoID, revision))
+		if err := finishEncodeJob(jobID, "ERROR", "Cannot Store Outputs", err.Error()); err != nil {
+			return err
+		}
+		failVideo(videoID, userID, "Cannot Store Outputs", true)
+		return nil
+	}
+	if err := completeVideo(videoID, userID, videoCreated, revision, result.VideoOutputs); err != nil {
+		Storage.Delete(OutputsKey(videoID, revision))
+		return err
+	}
+	if err := finishEncodeJob(jobID, "FINISH", "", ""); err != nil {
+		return err
+	}
+	log.Printf("[env/workers] Video Processed: %s\n", videoID)
+	return nil
+}
+
+// Queue Videos again whose Workers stopped checking in
+func startLeaseExpiry(stop context.Context) {
+	t := time.NewTicker(time.Duration(max(WORKER_LEASE/4, 1)) * time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop.Done():
+			return
+		case <-t.C:
+		}
+		videoIDs, err := queryIDs(
+			`UPDATE encode_jobs SET status = 'CANCEL', finished = CURRENT_TIMESTAMP, error = 'Lease Expired'
+			WHERE status = 'PROCESS' AND lease_expires <= CURRENT_TIMESTAMP
+			RETURNING video_id`,
+		)
+		if err != nil {
+			log.Println("[env/workers] Cannot Expire Leases:", err)
+			continue
+		}
+		for _, videoID := range videoIDs {
+			log.Printf("[env/workers] Lease Expired (ID: %s)\n", videoID)
+			Storage.Delete("pending/" + videoID)
+			if err := requeueVideo(videoID); err != nil {
+				log.Printf("[env/workers] Cannot Queue Video (ID: %s): %s\n", videoID, err)
+			}
+		}
+	}
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"path"
 	"shareclip/env"
 	"shareclip/routes"
 	"shareclip/tools"
@@ -18,11 +20,38 @@ import (
 )
 
 func main() {
+	// Run as a Remote Worker, which doesn't need a database
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		RunWorker(os.Args[2:])
+		return
+	}
+
 	// Startup Services
 	var stopCtx, stop = context.WithCancel(context.Background())
 	var stopWg sync.WaitGroup
+	env.SetupData()
+	if err := env.SetupProfiles(); err != nil {
+		log.Fatalln("[env/profiles]", err)
+	}
 	env.StartDatabase(stopCtx, &stopWg)
+
+	// Run Administrator Commands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "reconcile":
+			RunReconcile(os.Args[2:])
+		default:
+			log.Fatalln("[main] Unknown Command:", os.Args[1])
+		}
+		stop()
+		stopWg.Wait()
+		return
+	}
+
+	env.EnvRequire("DISCORD_REDIRECT", "DISCORD_CLIENT_ID", "DISCORD_SECRET")
+	env.ReconcileStartup()
 	env.StartEncoders(stopCtx, &stopWg)
+	env.StartRetention(stopCtx, &stopWg)
 	routes.SetupSPA()
 	SetupHTTP(stopCtx, &stopWg)
 
@@ -46,26 +75,70 @@ func main() {
 	os.Exit(1)
 }
 
-func SetupHTTP(stop context.Context, await *sync.WaitGroup) {
+// Register every Route
+// - Client IPs are only read from X-Forwarded-For when the request came through a trusted proxy,
+// otherwise anyone could pick their own IP to get around rate limits
+func SetupRouter() *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 
 	r := gin.New()
+	if err := r.SetTrustedProxies(env.TRUSTED_PROXIES); err != nil {
+		log.Fatalln("[http] Invalid Trusted Proxies:", err)
+	}
 	r.Use(tools.Logger)
-	r.Static("/public", path.Join(env.DATA_DIR, "public"))
+	r.GET("/public/:id/*file", tools.SessionOptional, routes.GET_Public)
+	r.HEAD("/public/:id/*file", tools.SessionOptional, routes.GET_Public)
 	r.GET("/api/oauth2", routes.GET_oAuth2_Callback)
 	r.GET("/api/logout", tools.Session, routes.GET_Logout)
 	r.GET("/api/events", tools.Session, routes.GET_Events)
 	r.POST("/api/videos", tools.Session, routes.POST_Upload)
+	r.GET("/api/profiles", routes.GET_Profiles)
+	r.POST("/api/uploads", tools.Session, routes.POST_Uploads)
+	r.GET("/api/uploads/:id", tools.Session, routes.GET_Uploads_ID)
+	r.PATCH("/api/uploads/:id", tools.Session, routes.PATCH_Uploads_ID)
+	r.POST("/api/uploads/:id/finalize", tools.Session, routes.POST_Uploads_ID_Finalize)
 	r.GET("/api/videos", tools.Session, routes.GET_Videos)
-	r.GET("/api/videos/:id", routes.GET_Videos_ID)
+	r.GET("/api/videos/:id", tools.SessionOptional, routes.GET_Videos_ID)
+	r.PATCH("/api/videos/:id", tools.Session, routes.PATCH_Videos_ID)
+	r.DELETE("/api/videos/:id", tools.Session, routes.DELETE_Videos_ID)
+	r.POST("/api/videos/:id/reencode", tools.Session, routes.POST_Videos_ID_Reencode)
+	r.POST("/api/videos/:id/shares", tools.Session, routes.POST_Videos_ID_Shares)
+	r.DELETE("/api/videos/:id/shares", tools.Session, routes.DELETE_Videos_ID_Shares)
+	r.POST("/api/videos/:id/report", tools.RateLimit(env.REPORTS_PER_HOUR, time.Hour), tools.SessionOptional, routes.POST_Videos_ID_Report)
 	r.GET("/api/users/@me", tools.Session, routes.GET_Users_Me)
+	r.GET("/api/users/:id/videos", routes.GET_Users_ID_Videos)
+	r.GET("/api/admin/videos", tools.Session, tools.Admin, routes.GET_Admin_Videos)
+	r.DELETE("/api/admin/videos/:id", tools.Session, tools.Admin, routes.DELETE_Admin_Videos_ID)
+	r.POST("/api/admin/users/:id/ban", tools.Session, tools.Admin, routes.POST_Admin_Users_ID_Ban)
+	r.DELETE("/api/admin/users/:id/ban", tools.Session, tools.Admin, routes.DELETE_Admin_Users_ID_Ban)
+	r.GET("/api/admin/queue", tools.Session, tools.Admin, routes.GET_Admin_Queue)
+	r.GET("/api/admin/jobs", tools.Session, tools.Admin, routes.GET_Admin_Jobs)
+	r.POST("/api/admin/reencode", tools.Session, tools.Admin, routes.POST_Admin_Reencode)
+	r.POST("/api/admin/reconcile", tools.Session, tools.Admin, routes.POST_Admin_Reconcile)
+	r.GET("/api/admin/reports", tools.Session, tools.Admin, routes.GET_Admin_Reports)
+	r.PUT("/api/admin/videos/:id/moderation", tools.Session, tools.Admin, routes.PUT_Admin_Videos_ID_Moderation)
+	r.POST("/api/workers/lease", tools.Worker, routes.POST_Workers_Lease)
+	r.GET("/api/workers/jobs/:id/original", tools.Worker, routes.GET_Workers_Jobs_ID_Original)
+	r.POST("/api/workers/jobs/:id/progress", tools.Worker, routes.POST_Workers_Jobs_ID_Progress)
+	r.PUT("/api/workers/jobs/:id/files/*file", tools.Worker, routes.PUT_Workers_Jobs_ID_Files)
+	r.POST("/api/workers/jobs/:id/finish", tools.Worker, routes.POST_Workers_Jobs_ID_Finish)
 	r.GET("/robots.txt", func(c *gin.Context) {
 		c.String(http.StatusOK, "User-agent: *\nDisallow: /")
 	})
 	r.NoRoute(routes.GET_Index)
+	return r
+}
 
+// Start the HTTP Server in the Background
+func SetupHTTP(stop context.Context, await *sync.WaitGroup) {
+	var handlers sync.WaitGroup // Requests still being handled, which can outlive their connection
+	router := SetupRouter()
 	svr := http.Server{
-		Handler:           r,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers.Add(1)
+			defer handlers.Done()
+			router.ServeHTTP(w, r)
+		}),
 		Addr:              env.HTTP_BIND,
 		TLSConfig:         env.HTTP_TLS,
 		MaxHeaderBytes:    4096,
@@ -77,23 +150,77 @@ func SetupHTTP(stop context.Context, await *sync.WaitGroup) {
 	}
 
 	// Shutdown Logic
+	// Requests in progress are given a while to finish, they need the database so it stays open until then
+	svr.RegisterOnShutdown(env.CloseEvents)
+	release := env.HoldDatabase()
 	await.Add(1)
 	go func() {
 		defer await.Done()
+		defer release()
 		<-stop.Done()
-		svr.Shutdown(context.Background())
+		timeout, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := svr.Shutdown(timeout); err != nil {
+			log.Println("[http] Closing Remaining Connections:", err)
+			svr.Close()
+		}
+		handlers.Wait()
 		log.Println("[http] Cleaned up HTTP")
 	}()
 
 	// Server Startup
-	var err error
 	log.Printf("[http] Setup HTTP (Addr: %s)\n", svr.Addr)
-	if env.TLS_ENABLED {
-		err = svr.ListenAndServeTLS("", "")
-	} else {
-		err = svr.ListenAndServe()
+	go func() {
+		var err error
+		if env.TLS_ENABLED {
+			err = svr.ListenAndServeTLS("", "")
+		} else {
+			err = svr.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			log.Fatalln("[http] Listen Error:", err)
+		}
+	}()
+}
+
+// Cross-check the Database against Storage and print what was found
+// - Usage: shareclip reconcile [-fix]
+func RunReconcile(args []string) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "Correct drift instead of only reporting it")
+	flags.Parse(args)
+
+	report, err := env.Reconcile(*fix)
+	if err != nil {
+		log.Fatalln("[main] Cannot Reconcile:", err)
+	}
+	b, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(b))
+}
+
+// Encode Videos for the Main Server until Interrupted
+// - Usage: shareclip worker -server https://example.com [-name worker-1]
+func RunWorker(args []string) {
+	hostname, _ := os.Hostname()
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	server := flags.String("server", os.Getenv("WORKER_SERVER"), "URL of the Main Server")
+	name := flags.String("name", hostname, "Name recorded alongside each Encoding Attempt")
+	flags.Parse(args)
+	if *server == "" {
+		log.Fatalln("[main] Missing Server URL, use -server or set WORKER_SERVER")
 	}
-	if err != http.ErrServerClosed {
-		log.Fatalln("[http] Listen Error:", err)
+	if env.WORKER_SECRET == "" {
+		log.Fatalln("[main] Missing Shared Secret, set WORKER_SECRET")
 	}
+
+	var stopCtx, stop = context.WithCancel(context.Background())
+	var stopWg sync.WaitGroup
+	env.StartRemoteWorker(stopCtx, &stopWg, *server, *name)
+
+	cancel := make(chan os.Signal, 1)
+	signal.Notify(cancel, syscall.SIGINT, syscall.SIGTERM)
+	<-cancel
+	stop()
+	stopWg.Wait()
+	log.Println("[main] All done, bye bye!")
 }
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"shareclip/env"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Work from a Temporary Data Directory using Disk Storage
+	dir, err := os.MkdirTemp("", "shareclip-test-*")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	env.DATA_DIR, env.STORAGE_BACKEND = dir, "disk"
+	env.SetupData()
+	if err := env.SetupProfiles(); err != nil {
+		log.Fatalln(err)
+	}
+	stop, cancel := context.WithCancel(context.Background())
+	await := sync.WaitGroup{}
+	env.StartDatabase(stop, &await)
+
+	code := m.Run()
+	cancel()
+	await.Wait()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestReportForgedIP(t *testing.T) {
+	autoHide := env.REPORTS_AUTO_HIDE
+	env.REPORTS_AUTO_HIDE = 2
+	t.Cleanup(func() { env.REPORTS_AUTO_HIDE = autoHide })
+	if _, err := env.DB.Exec("INSERT INTO users (id, name) VALUES ('reportOwner', 'Tester')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DB.Exec("INSERT INTO videos (id, user_id, status, published) VALUES ('reportVideo', 'reportOwner', 'FINISH', 1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same client claims to be someone else each time
+	r := SetupRouter()
+	for _, forged := range []string{"203.0.113.1", "203.0.113.2"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/videos/reportVideo/report", strings.NewReader(`{"reason": "spam"}`))
+		req.RemoteAddr = "198.51.100.7:1234"
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forged)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("Report returned %d, expected %d", w.Code, http.StatusNoContent)
+		}
+	}
+
+	var reports int
+	var moderation string
+	env.DB.QueryRow("SELECT COUNT(*) FROM reports WHERE video_id = 'reportVideo'").Scan(&reports)
+	env.DB.QueryRow("SELECT moderation FROM videos WHERE id = 'reportVideo'").Scan(&moderation)
+	if reports != 1 || moderation != "REVIEW" {
+		t.Errorf("Stored %d reports with moderation %s, expected 1 with REVIEW", reports, moderation)
+	}
+}
+
+func TestSharePlaylist(t *testing.T) {
+	if _, err := env.DB.Exec("INSERT INTO users (id, name) VALUES ('shareOwner', 'Tester')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DB.Exec(
+		"INSERT INTO videos (id, user_id, status, published, visibility) VALUES ('shareVideo1', 'shareOwner', 'FINISH', 1, 'PRIVATE')",
+	); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DB.Exec("INSERT INTO shares (id, video_id, max_views) VALUES ('shareLink01', 'shareVideo1', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	for key, content := range map[string]string{
+		env.OUTPUT_FILENAME_PLAYLIST: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\n720p.m3u8\n",
+		"720p.m3u8":                  "#EXTM3U\n#EXTINF:2.0,\n720p_000.ts\n#EXT-X-ENDLIST\n",
+		"720p_000.ts":                "segment",
+	} {
+		if err := env.Storage.Put("public/shareVideo1/"+key, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token := env.SignShare("shareVideo1", "", "shareLink01", time.Now().Add(time.Hour))
+
+	// Media proxies fetch without cookies, following the URIs in each playlist
+	r := SetupRouter()
+	fetch := func(target, agent string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("User-Agent", agent)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+	reference := func(playlist string) string {
+		lines := strings.Split(strings.TrimSpace(playlist), "\n")
+		for i := len(lines) - 1; i >= 0; i-- {
+			if !strings.HasPrefix(lines[i], "#") {
+				return "/public/shareVideo1/" + lines[i]
+			}
+		}
+		t.Fatalf("Playlist references nothing:\n%s", playlist)
+		return ""
+	}
+	target := "/public/shareVideo1/" + env.OUTPUT_FILENAME_PLAYLIST + "?share=" + url.QueryEscape(token)
+	for _, name := range []string{"playlist", "rendition", "segment"} {
+		code, body := fetch(target, "proxy")
+		if code != http.StatusOK {
+			t.Fatalf("Fetching the %s returned %d, expected %d", name, code, http.StatusOK)
+		}
+		if name != "segment" {
+			target = reference(body)
+		}
+	}
+	if code, _ := fetch("/public/shareVideo1/"+env.OUTPUT_FILENAME_PLAYLIST+"?share="+url.QueryEscape(token), "proxy"); code != http.StatusOK {
+		t.Errorf("Fetching the playlist again returned %d, expected %d", code, http.StatusOK)
+	}
+	if code, _ := fetch("/public/shareVideo1/"+env.OUTPUT_FILENAME_PLAYLIST+"?share="+url.QueryEscape(token), "someone else"); code != http.StatusNotFound {
+		t.Errorf("Another viewer fetching the playlist returned %d, expected %d", code, http.StatusNotFound)
+	}
+
+	var views int
+	env.DB.QueryRow("SELECT views FROM shares WHERE id = 'shareLink01'").Scan(&views)
+	if views != 1 {
+		t.Errorf("Counted %d views, expected 1", views)
+	}
+}
+
+func TestReportAutoHide(t *testing.T) {
+	autoHide := env.REPORTS_AUTO_HIDE
+	env.REPORTS_AUTO_HIDE = 2
+	t.Cleanup(func() { env.REPORTS_AUTO_HIDE = autoHide })
+	if _, err := env.DB.Exec("INSERT INTO users (id, name) VALUES ('hiddenOwner', 'Tester')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DB.Exec("INSERT INTO videos (id, user_id, status, published) VALUES ('hiddenVideo', 'hiddenOwner', 'FINISH', 1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := SetupRouter()
+	for _, address := range []string{"198.51.100.8:1234", "198.51.100.9:1234"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/videos/hiddenVideo/report", strings.NewReader(`{"reason": "spam"}`))
+		req.RemoteAddr = address
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("Report returned %d, expected %d", w.Code, http.StatusNoContent)
+		}
+	}
+
+	// Hidden videos are held back like removed ones, but can still be told apart from a takedown
+	var moderation string
+	env.DB.QueryRow("SELECT moderation FROM videos WHERE id = 'hiddenVideo'").Scan(&moderation)
+	if moderation != "HIDDEN" {
+		t.Errorf("Moderation is %s, expected HIDDEN", moderation)
+	}
+	for _, target := range []string{"/api/videos/hiddenVideo", "/public/hiddenVideo/" + env.OUTPUT_FILENAME_VIDEO} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Fetching %s returned %d, expected %d", target, w.Code, http.StatusNotFound)
+		}
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/users/hiddenOwner/videos", nil))
+	if strings.Contains(w.Body.String(), "hiddenVideo") {
+		t.Errorf("Hidden video was listed: %s", w.Body.String())
+	}
+}
+
+func TestFinalizeRetry(t *testing.T) {
+	if _, err := env.DB.Exec("INSERT INTO users (id, name, token) VALUES ('finalizeOwner', 'Tester', 'finalizeToken')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DB.Exec(
+		"INSERT INTO uploads (id, user_id, filename, size, received) VALUES ('finalizeClip', 'finalizeOwner', 'clip.mp4', 8, 8)",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// An earlier attempt moved the original into storage but failed to queue it
+	if err := env.Storage.Put("video/finalizeClip", strings.NewReader("original"), 8); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/uploads/finalizeClip/finalize", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "finalizeToken"})
+	w := httptest.NewRecorder()
+	SetupRouter().ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Finalize returned %d, expected %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+
+	var status string
+	var uploads int
+	env.DB.QueryRow("SELECT status FROM videos WHERE id = 'finalizeClip'").Scan(&status)
+	env.DB.QueryRow("SELECT COUNT(*) FROM uploads WHERE id = 'finalizeClip'").Scan(&uploads)
+	if status != "QUEUE" || uploads != 0 {
+		t.Errorf("Video is %q with %d uploads left, expected QUEUE with none", status, uploads)
+	}
+}
+
+func TestTrimDuration(t *testing.T) {
+	if _, err := env.DB.Exec("INSERT INTO users (id, name, token) VALUES ('trimOwner', 'Tester', 'trimToken')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DB.Exec(
+		"INSERT INTO videos (id, user_id, status, duration, original_duration) VALUES ('trimVideo01', 'trimOwner', 'QUEUE', 30, 30)",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	r := SetupRouter()
+	for _, tt := range []struct {
+		body     string
+		duration float64
+	}{
+		{`{"trim_start": 5, "trim_end": 20}`, 15},
+		{`{"trim_end": 0}`, 25},
+		{`{"title": "Untouched"}`, 25},
+	} {
+		req := httptest.NewRequest(http.MethodPatch, "/api/videos/trimVideo01", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "session", Value: "trimToken"})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Update %s returned %d, expected %d: %s", tt.body, w.Code, http.StatusOK, w.Body.String())
+		}
+		var duration float64
+		env.DB.QueryRow("SELECT duration FROM videos WHERE id = 'trimVideo01'").Scan(&duration)
+		if duration != tt.duration {
+			t.Errorf("Update %s left a duration of %g, expected %g", tt.body, duration, tt.duration)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Lift the Ban on a User
+func DELETE_Admin_Users_ID_Ban(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	r, err := env.DB.Exec("UPDATE users SET banned = NULL WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown User")
+		return
+	}
+	log.Printf("[admin] %s unbanned user %s\n", userSession.ID, c.Param("id"))
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Delete any video regardless of owner
+func DELETE_Admin_Videos_ID(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	switch err := env.DeleteVideo(c.Param("id")); {
+	case err == sql.ErrNoRows:
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Video")
+	case err != nil:
+		c.AbortWithError(http.StatusInternalServerError, err)
+	default:
+		log.Printf("[admin] %s deleted video %s\n", userSession.ID, c.Param("id"))
+		c.Status(http.StatusNoContent)
+	}
+}
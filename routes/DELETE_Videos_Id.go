@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Delete a video owned by the currently logged in user
+func DELETE_Videos_ID(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	var VideoID string
+	err := env.DB.
+		QueryRow("SELECT id FROM videos WHERE id = $1 AND user_id = $2", c.Param("id"), userSession.ID).
+		Scan(&VideoID)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Video")
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	switch err := env.DeleteVideo(VideoID); {
+	case err == sql.ErrNoRows:
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Video")
+	case err != nil:
+		c.AbortWithError(http.StatusInternalServerError, err)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Revoke all share links for a video owned by the currently logged in user
+func DELETE_Videos_ID_Shares(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	result, err := env.DB.Exec(
+		"UPDATE videos SET share_key = $1 WHERE id = $2 AND user_id = $3",
+		tools.GenerateToken(), c.Param("id"), userSession.ID,
+	)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Video")
+		return
+	}
+	if _, err := env.DB.Exec("DELETE FROM shares WHERE video_id = $1", c.Param("id")); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
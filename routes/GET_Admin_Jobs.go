@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"net/http"
+	"shareclip/env"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fetch encoding attempts across all videos, newest first
+// - Optional Query: ?video_id=...&status=...&limit=100&offset=0
+func GET_Admin_Jobs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Limit")
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Offset")
+		return
+	}
+	jobs, err := env.ListEncodeJobs(c.Query("video_id"), c.Query("status"), limit, offset)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
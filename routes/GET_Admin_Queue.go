@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"math"
+	"net/http"
+	"shareclip/env"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fetch all videos waiting for or currently being encoded
+func GET_Admin_Queue(c *gin.Context) {
+	active := env.EncoderActive()
+	queuedVideos := []gin.H{}
+	queue, err := env.QueueStatus()
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	rows, err := env.DB.Query(
+		`SELECT id, created, status, size, user_id, duration FROM videos
+		WHERE status IN ('QUEUE', 'PROCESS') ORDER BY status = 'QUEUE', created`,
+	)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			VideoID      string
+			VideoCreated string
+			VideoStatus  string
+			VideoSize    int64
+			UserID       string
+			VideoLength  *float64
+		)
+		if err := rows.Scan(&VideoID, &VideoCreated, &VideoStatus, &VideoSize, &UserID, &VideoLength); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		QueuePosition, QueueETA := queuePosition(queue, VideoID)
+		queuedVideos = append(queuedVideos, gin.H{
+			"id":       VideoID,
+			"created":  VideoCreated,
+			"status":   VideoStatus,
+			"size":     VideoSize,
+			"user_id":  UserID,
+			"encoding": active[VideoID],
+			"duration": VideoLength,
+			"position": QueuePosition,
+			"eta":      QueueETA,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	// Processing videos first, then in the order they will be encoded
+	// Videos waiting to be retried have no position and are listed last
+	order := func(v gin.H) int {
+		if p := v["position"].(*int); p != nil {
+			return *p
+		}
+		if v["status"] == "PROCESS" {
+			return 0
+		}
+		return math.MaxInt
+	}
+	sort.SliceStable(queuedVideos, func(i, j int) bool {
+		return order(queuedVideos[i]) < order(queuedVideos[j])
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"workers": env.ENCODER_WORKERS,
+		"videos":  queuedVideos,
+	})
+}
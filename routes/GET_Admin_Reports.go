@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"net/http"
+	"shareclip/env"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fetch reports waiting for review, oldest first
+// - Optional Query: ?resolved=true&limit=100&offset=0
+func GET_Admin_Reports(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Limit")
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Offset")
+		return
+	}
+
+	allReports := []gin.H{}
+	rows, err := env.DB.Query(
+		`SELECT r.id, r.created, r.video_id, r.user_id, r.ip, r.reason, r.details, r.resolved, v.title, v.user_id, v.moderation
+		FROM reports r JOIN videos v ON v.id = r.video_id
+		WHERE r.resolved = $1
+		ORDER BY r.created LIMIT $2 OFFSET $3`,
+		c.Query("resolved") == "true", limit, offset,
+	)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			ReportID        int64
+			ReportCreated   string
+			ReportVideoID   string
+			ReportUserID    *string
+			ReportIP        string
+			ReportReason    string
+			ReportDetails   string
+			ReportResolved  bool
+			VideoTitle      string
+			VideoUserID     string
+			VideoModeration string
+		)
+		if err := rows.Scan(
+			&ReportID, &ReportCreated, &ReportVideoID, &ReportUserID, &ReportIP, &ReportReason,
+			&ReportDetails, &ReportResolved, &VideoTitle, &VideoUserID, &VideoModeration,
+		); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		allReports = append(allReports, gin.H{
+			"id":       ReportID,
+			"created":  ReportCreated,
+			"user_id":  ReportUserID,
+			"ip":       ReportIP,
+			"reason":   ReportReason,
+			"details":  ReportDetails,
+			"resolved": ReportResolved,
+			"video": gin.H{
+				"id":         ReportVideoID,
+				"title":      VideoTitle,
+				"user_id":    VideoUserID,
+				"moderation": VideoModeration,
+			},
+		})
+	}
+	c.JSON(http.StatusOK, allReports)
+}
@@ -0,0 +1,63 @@
+package routes
+
+import (
+	"net/http"
+	"shareclip/env"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fetch videos across all users, newest first
+// - Optional Query: ?user_id=...&status=...&limit=100&offset=0
+func GET_Admin_Videos(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Limit")
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Offset")
+		return
+	}
+
+	allVideos := []gin.H{}
+	rows, err := env.DB.Query(
+		`SELECT v.id, v.created, v.status, v.title, v.size, v.user_id, u.name
+		FROM videos v JOIN users u ON u.id = v.user_id
+		WHERE ($1 = '' OR v.user_id = $1) AND ($2 = '' OR v.status = $2)
+		ORDER BY v.created DESC LIMIT $3 OFFSET $4`,
+		c.Query("user_id"), c.Query("status"), limit, offset,
+	)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			VideoID      string
+			VideoCreated string
+			VideoStatus  string
+			VideoTitle   string
+			VideoSize    int64
+			UserID       string
+			UserName     *string
+		)
+		if err := rows.Scan(&VideoID, &VideoCreated, &VideoStatus, &VideoTitle, &VideoSize, &UserID, &UserName); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		allVideos = append(allVideos, gin.H{
+			"id":        VideoID,
+			"created":   VideoCreated,
+			"status":    VideoStatus,
+			"title":     VideoTitle,
+			"size":      VideoSize,
+			"user_id":   UserID,
+			"user_name": UserName,
+		})
+	}
+	c.JSON(http.StatusOK, allVideos)
+}
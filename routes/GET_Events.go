@@ -15,11 +15,17 @@ func GET_Events(c *gin.Context) {
 	// Create Events for User
 	EVENTS := make(chan string, 16)
 	env.EventMutex.Lock()
-	env.EventChannels[userSession.ID] = EVENTS
+	if env.EventChannels[userSession.ID] == nil {
+		env.EventChannels[userSession.ID] = map[chan string]bool{}
+	}
+	env.EventChannels[userSession.ID][EVENTS] = true
 	env.EventMutex.Unlock()
 	defer func() {
 		env.EventMutex.Lock()
-		delete(env.EventChannels, userSession.ID)
+		delete(env.EventChannels[userSession.ID], EVENTS)
+		if len(env.EventChannels[userSession.ID]) == 0 {
+			delete(env.EventChannels, userSession.ID)
+		}
 		close(EVENTS)
 		env.EventMutex.Unlock()
 	}()
@@ -30,6 +36,8 @@ func GET_Events(c *gin.Context) {
 		select {
 		case <-c.Request.Context().Done():
 			return false
+		case <-env.EventsClosed:
+			return false
 		case e := <-EVENTS:
 			c.SSEvent("data", e)
 			return true
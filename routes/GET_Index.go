@@ -7,8 +7,12 @@ import (
 	"database/sql"
 	_ "embed"
 	"fmt"
+	"html"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
 	"shareclip/env"
 	"shareclip/tools"
 	"strings"
@@ -59,9 +63,30 @@ func GET_Index(c *gin.Context) {
 			c.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
+		var VideoTitle, VideoDesc, VideoVisibility string
+		var VideoAnimated bool
 		err := env.DB.
-			QueryRow("SELECT id FROM videos WHERE id = $1 AND status = 'FINISH'", VideoID).
-			Scan(&VideoID)
+			QueryRow("SELECT id, title, description, visibility, animated FROM videos WHERE id = $1 AND published = 1 AND moderation NOT IN ('HIDDEN', 'REMOVED')", VideoID).
+			Scan(&VideoID, &VideoTitle, &VideoDesc, &VideoVisibility, &VideoAnimated)
+		if VideoTitle == "" {
+			VideoTitle = "Clips"
+		}
+
+		// Private Videos can only be embedded with a Share Link
+		var VideoQuery string
+		if err == nil && VideoVisibility == "PRIVATE" {
+			var shared bool
+			if shared, err = env.CheckShare(VideoID, c.Query("share"), shareViewer(c), false); err == nil && !shared {
+				err = sql.ErrNoRows
+			}
+			VideoQuery = "?share=" + url.QueryEscape(c.Query("share"))
+		}
+
+		// Prefer the Animated Preview as the Embed Image when one was generated
+		VideoImage := env.OUTPUT_FILENAME_THUMBNAIL
+		if VideoAnimated {
+			VideoImage = env.OUTPUT_FILENAME_ANIMATED
+		}
 
 		// Render Embed Webpage
 		switch {
@@ -75,18 +100,25 @@ func GET_Index(c *gin.Context) {
 				"<!DOCTYPE html>"+
 				"<html>"+
 				/**/ "<head>"+
-				/**/ /**/ "<title>Clips</title>"+
+				/**/ /**/ "<title>%[5]s</title>"+
+				/**/ /**/ "<meta property=\"og:title\" content=\"%[5]s\">"+
+				/**/ /**/ "<meta property=\"og:description\" content=\"%[6]s\">"+
 				/**/ /**/ "<meta property=\"og:type\" content=\"video.other\">"+
-				/**/ /**/ "<meta property=\"og:image\" content=\"https://%[1]s/public/%[2]s/%[3]s\">"+
-				/**/ /**/ "<meta property=\"og:video:url\" content=\"https://%[1]s/public/%[2]s/%[4]s\">"+
+				/**/ /**/ "<meta property=\"og:image\" content=\"https://%[1]s/public/%[2]s/%[3]s%[7]s\">"+
+				/**/ /**/ "<meta property=\"og:image:type\" content=\"%[8]s\">"+
+				/**/ /**/ "<meta property=\"og:video:url\" content=\"https://%[1]s/public/%[2]s/%[4]s%[7]s\">"+
 				/**/ /**/ "<meta property=\"og:video:width\" content=\"1920\">"+
 				/**/ /**/ "<meta property=\"og:video:height\" content=\"1080\">"+
 				/**/ "</head>"+
 				"</html>",
 				c.Request.Host,
 				VideoID,
-				env.OUTPUT_FILENAME_THUMBNAIL,
+				VideoImage,
 				env.OUTPUT_FILENAME_VIDEO,
+				html.EscapeString(VideoTitle),
+				html.EscapeString(VideoDesc),
+				html.EscapeString(VideoQuery),
+				mime.TypeByExtension(path.Ext(VideoImage)),
 			)
 		}
 		return
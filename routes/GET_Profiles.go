@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"net/http"
+	"shareclip/env"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List the Encoding Profiles an Upload can choose from
+func GET_Profiles(c *gin.Context) {
+	profiles := []gin.H{}
+	for _, name := range env.ProfileNames() {
+		profiles = append(profiles, gin.H{
+			"name":        name,
+			"description": env.ENCODER_PROFILES[name].Description,
+			"default":     name == env.PROFILE_DEFAULT,
+		})
+	}
+	c.JSON(http.StatusOK, profiles)
+}
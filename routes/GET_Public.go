@@ -0,0 +1,171 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"shareclip/env"
+	"shareclip/tools"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Matches the URIs within the tags of an HLS Playlist
+var playlistURI = regexp.MustCompile(`URI="([^"]*)"`)
+
+// Identify a Viewer of Share Links across requests so each person only uses up one view
+// - Playlists pass the viewer along to the files they reference, otherwise the cookie is used
+// - Clients without cookies, such as media proxies, are told apart by their address and user agent
+// instead of becoming a new viewer on every request
+func shareViewer(c *gin.Context) string {
+	if v := c.Query("viewer"); v != "" && len(v) <= 64 {
+		return v
+	}
+	if v, err := c.Cookie("share_viewer"); err == nil && v != "" && len(v) <= 64 {
+		return v
+	}
+	h := sha256.Sum256([]byte(c.ClientIP() + "\n" + c.Request.UserAgent()))
+	v := hex.EncodeToString(h[:])
+	c.SetCookie("share_viewer", v, int(env.SHARE_MAX_LIFETIME.Seconds()), "/", "", env.TLS_ENABLED, true)
+	return v
+}
+
+// Add the Share Token and Viewer to every URI in an HLS Playlist so segments can be fetched without cookies
+func sharePlaylist(playlist []byte, token, viewer string) []byte {
+	query := "share=" + url.QueryEscape(token) + "&viewer=" + url.QueryEscape(viewer)
+	withQuery := func(uri string) string {
+		if strings.Contains(uri, "?") {
+			return uri + "&" + query
+		}
+		return uri + "?" + query
+	}
+	lines := strings.Split(string(playlist), "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			lines[i] = playlistURI.ReplaceAllStringFunc(line, func(m string) string {
+				return `URI="` + withQuery(playlistURI.FindStringSubmatch(m)[1]) + `"`
+			})
+		default:
+			lines[i] = withQuery(line)
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// Serve a processed file from Storage
+func GET_Public(c *gin.Context) {
+	videoID := c.Param("id")
+	if !tools.IDMatcher.MatchString(videoID) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	file := path.Clean("/" + c.Param("file"))
+
+	// Removed Videos are only visible to Administrators
+	// Private Videos are only visible to their Owner or with a Share Link
+	// Files are served from the revision of outputs the video was last published with
+	var VideoOwner, VideoVisibility, VideoModeration, VideoRevision string
+	var VideoPublished bool
+	err := env.DB.
+		QueryRow("SELECT user_id, visibility, moderation, published, revision FROM videos WHERE id = $1", videoID).
+		Scan(&VideoOwner, &VideoVisibility, &VideoModeration, &VideoPublished, &VideoRevision)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	viewer, _ := tools.GetUser(c)
+	if (VideoModeration == "HIDDEN" || VideoModeration == "REMOVED") && !viewer.Admin {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if !VideoPublished && viewer.ID != VideoOwner && !viewer.Admin {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	key := env.OutputsKey(videoID, VideoRevision) + file
+	shared := ""
+	if VideoVisibility == "PRIVATE" {
+		if viewer.ID != VideoOwner {
+			// Only starting to watch the video uses up a view, previews and segments don't
+			shared = shareViewer(c)
+			consume := file == "/"+env.OUTPUT_FILENAME_VIDEO || file == "/"+env.OUTPUT_FILENAME_PLAYLIST
+			ok, err := env.CheckShare(videoID, c.Query("share"), shared, consume)
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+			if !ok {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+		}
+		c.Header("Cache-Control", "private, no-store")
+	}
+
+	// Playlists are rewritten so the files they reference carry the share link
+	if shared != "" && path.Ext(file) == ".m3u8" {
+		r, err := env.Storage.Get(key)
+		if errors.Is(err, fs.ErrNotExist) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		playlist, err := io.ReadAll(io.LimitReader(r, 1<<20))
+		r.Close()
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		c.Data(http.StatusOK, "application/vnd.apple.mpegurl", sharePlaylist(playlist, c.Query("share"), shared))
+		return
+	}
+
+	// Redirect to Storage Backend
+	if u := env.Storage.URL(key); u != "" {
+		c.Redirect(http.StatusTemporaryRedirect, u)
+		return
+	}
+
+	// Serve from Storage Backend
+	r, err := env.Storage.Get(key)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer r.Close()
+	modified := time.Time{}
+	if f, ok := r.(*os.File); ok {
+		if s, err := f.Stat(); err == nil {
+			modified = s.ModTime()
+		}
+	}
+	if rs, ok := r.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, key, modified, rs)
+		return
+	}
+	c.DataFromReader(http.StatusOK, -1, "", r, nil)
+}
@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fetch the progress of an incomplete upload so it can be resumed
+func GET_Uploads_ID(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	var (
+		UploadID       string
+		UploadFilename string
+		UploadSize     int64
+		UploadReceived int64
+	)
+	err := env.DB.
+		QueryRow(
+			"SELECT id, filename, size, received FROM uploads WHERE id = $1 AND user_id = $2",
+			c.Param("id"), userSession.ID,
+		).
+		Scan(&UploadID, &UploadFilename, &UploadSize, &UploadReceived)
+
+	switch {
+	case err == sql.ErrNoRows:
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Upload")
+	case err != nil:
+		c.AbortWithError(http.StatusInternalServerError, err)
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"id":       UploadID,
+			"filename": UploadFilename,
+			"size":     UploadSize,
+			"received": UploadReceived,
+		})
+	}
+}
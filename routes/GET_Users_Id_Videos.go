@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"net/http"
+	"shareclip/env"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fetch the public videos of a user, unlisted and private videos are excluded
+func GET_Users_ID_Videos(c *gin.Context) {
+	userVideos := []gin.H{}
+	rows, err := env.DB.Query(
+		`SELECT id, created, title, description FROM videos
+		WHERE user_id = $1 AND published = 1 AND visibility = 'PUBLIC' AND moderation NOT IN ('HIDDEN', 'REMOVED')
+		ORDER BY created DESC`,
+		c.Param("id"),
+	)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			VideoID      string
+			VideoCreated string
+			VideoTitle   string
+			VideoDesc    string
+		)
+		if err := rows.Scan(&VideoID, &VideoCreated, &VideoTitle, &VideoDesc); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		userVideos = append(userVideos, gin.H{
+			"id":          VideoID,
+			"created":     VideoCreated,
+			"title":       VideoTitle,
+			"description": VideoDesc,
+		})
+	}
+	c.JSON(http.StatusOK, userVideos)
+}
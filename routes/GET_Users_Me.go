@@ -2,11 +2,23 @@ package routes
 
 import (
 	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
 
 	"github.com/gin-gonic/gin"
 )
 
 // Return already retrieved information about the current session
+// alongside their current quota usage
 func GET_Users_Me(c *gin.Context) {
-	c.JSON(http.StatusOK, c.MustGet("user"))
+	userSession := c.MustGet("user").(tools.RequestUser)
+	quota, err := env.GetQuota(userSession.ID)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, struct {
+		tools.RequestUser
+		Quota env.Quota `json:"quota"`
+	}{userSession, quota})
 }
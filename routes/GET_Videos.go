@@ -8,12 +8,28 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// Position and ETA of a Video in the Queue, nil if it isn't waiting
+// - Videos waiting to be retried have no position until they are due
+func queuePosition(entries map[string]env.QueueEntry, videoID string) (*int, *int64) {
+	if e, ok := entries[videoID]; ok {
+		return &e.Position, e.ETA
+	}
+	return nil, nil
+}
+
 // Fetch all videos for the currently logged in user
 func GET_Videos(c *gin.Context) {
 	userSession := c.MustGet("user").(tools.RequestUser)
 	userVideos := []gin.H{}
+	queue, err := env.QueueStatus()
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
 	rows, err := env.DB.Query(
-		"SELECT id, created, status FROM videos WHERE user_id = $1",
+		`SELECT id, created, status, title, description, moderation, visibility, profile, `+env.SQLExpires()+`,
+			(SELECT error FROM encode_jobs WHERE video_id = videos.id ORDER BY id DESC LIMIT 1)
+		FROM videos WHERE user_id = $1`,
 		userSession.ID,
 	)
 	if err != nil {
@@ -23,18 +39,35 @@ func GET_Videos(c *gin.Context) {
 	defer rows.Close()
 	for rows.Next() {
 		var (
-			VideoID      string
-			VideoCreated string
-			VideoStatus  string
+			VideoID         string
+			VideoCreated    string
+			VideoStatus     string
+			VideoTitle      string
+			VideoDesc       string
+			VideoModeration string
+			VideoVisibility string
+			VideoProfile    string
+			VideoExpires    *string
+			VideoError      *string
 		)
-		if err := rows.Scan(&VideoID, &VideoCreated, &VideoStatus); err != nil {
+		if err := rows.Scan(&VideoID, &VideoCreated, &VideoStatus, &VideoTitle, &VideoDesc, &VideoModeration, &VideoVisibility, &VideoProfile, &VideoExpires, &VideoError); err != nil {
 			c.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
+		QueuePosition, QueueETA := queuePosition(queue, VideoID)
 		userVideos = append(userVideos, gin.H{
-			"id":      VideoID,
-			"created": VideoCreated,
-			"status":  VideoStatus,
+			"id":             VideoID,
+			"created":        VideoCreated,
+			"status":         VideoStatus,
+			"title":          VideoTitle,
+			"description":    VideoDesc,
+			"moderation":     VideoModeration,
+			"visibility":     VideoVisibility,
+			"profile":        VideoProfile,
+			"expires":        VideoExpires,
+			"error":          VideoError,
+			"queue_position": QueuePosition,
+			"queue_eta":      QueueETA,
 		})
 	}
 	c.JSON(http.StatusOK, userVideos)
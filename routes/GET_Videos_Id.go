@@ -3,34 +3,108 @@ package routes
 import (
 	"database/sql"
 	"net/http"
+	"net/url"
 	"shareclip/env"
+	"shareclip/tools"
 
 	"github.com/gin-gonic/gin"
 )
 
 // Search Database for a video with the provided ID
+// Private videos are only visible to their owner or with a share link that has views left,
+// views are only used up once the video itself is fetched
+// The owner can also see unfinished videos alongside their encoding attempts
+// Videos being re-encoded keep serving their previous outputs until the new ones are published
 func GET_Videos_ID(c *gin.Context) {
 	var (
-		VideoID      string
-		VideoCreated string
-		VideoStatus  string
+		VideoID         string
+		VideoCreated    string
+		VideoStatus     string
+		VideoPublished  bool
+		VideoTitle      string
+		VideoDesc       string
+		VideoHLS        bool
+		VideoStoryboard bool
+		VideoRemoved    bool
+		VideoOwner      string
+		VideoVisibility string
+		VideoTrim       env.VideoTrim
+		VideoAudio      env.VideoAudio
 	)
 	err := env.DB.
-		QueryRow("SELECT id, created, status FROM videos WHERE id = $1", c.Param("id")).
-		Scan(&VideoID, &VideoCreated, &VideoStatus)
+		QueryRow(
+			`SELECT id, created, status, published, title, description, hls, storyboard, moderation IN ('HIDDEN', 'REMOVED'), user_id, visibility,
+				trim_start, trim_end, audio
+			FROM videos WHERE id = $1`,
+			c.Param("id"),
+		).
+		Scan(
+			&VideoID, &VideoCreated, &VideoStatus, &VideoPublished, &VideoTitle, &VideoDesc, &VideoHLS, &VideoStoryboard, &VideoRemoved, &VideoOwner, &VideoVisibility,
+			&VideoTrim.Start, &VideoTrim.End, &VideoAudio,
+		)
+	viewer, _ := tools.GetUser(c)
+	shared := false
+	if err == nil && !VideoRemoved && VideoPublished && VideoVisibility == "PRIVATE" && viewer.ID != VideoOwner {
+		shared, err = env.CheckShare(VideoID, c.Query("share"), shareViewer(c), false)
+	}
 
 	switch {
 	case err == sql.ErrNoRows:
 		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Video")
+	case err == nil && VideoVisibility == "PRIVATE" && viewer.ID != VideoOwner && !shared:
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Video")
 	case err != nil:
 		c.AbortWithError(http.StatusInternalServerError, err)
-	case VideoStatus != "FINISH":
+	case VideoRemoved:
+		c.AbortWithStatusJSON(http.StatusNotFound, "Video Removed")
+	case !VideoPublished && viewer.ID != VideoOwner:
 		c.AbortWithStatusJSON(http.StatusNotFound, "Processing Video")
 	default:
-		c.JSON(http.StatusOK, gin.H{
-			"id":      VideoID,
-			"created": VideoCreated,
-			"status":  VideoStatus,
-		})
+		var VideoManifest *string
+		if VideoHLS && VideoPublished {
+			m := "/public/" + VideoID + "/" + env.OUTPUT_FILENAME_PLAYLIST
+			if shared {
+				m += "?share=" + url.QueryEscape(c.Query("share"))
+			}
+			VideoManifest = &m
+		}
+		var VideoStoryboardURL *string
+		if VideoStoryboard && VideoPublished {
+			s := "/public/" + VideoID + "/" + env.OUTPUT_FILENAME_VTT
+			if shared {
+				s += "?share=" + url.QueryEscape(c.Query("share"))
+			}
+			VideoStoryboardURL = &s
+		}
+		video := gin.H{
+			"id":          VideoID,
+			"created":     VideoCreated,
+			"status":      VideoStatus,
+			"published":   VideoPublished,
+			"title":       VideoTitle,
+			"description": VideoDesc,
+			"visibility":  VideoVisibility,
+			"manifest":    VideoManifest,
+			"storyboard":  VideoStoryboardURL,
+		}
+		if viewer.ID == VideoOwner {
+			jobs, err := env.ListEncodeJobs(VideoID, "", 20, 0)
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+			video["jobs"] = jobs
+			video["trim_start"], video["trim_end"] = VideoTrim.Start, VideoTrim.End
+			video["audio"] = VideoAudio
+			if VideoStatus == "QUEUE" {
+				queue, err := env.QueueStatus()
+				if err != nil {
+					c.AbortWithError(http.StatusInternalServerError, err)
+					return
+				}
+				video["queue_position"], video["queue_eta"] = queuePosition(queue, VideoID)
+			}
+		}
+		c.JSON(http.StatusOK, video)
 	}
 }
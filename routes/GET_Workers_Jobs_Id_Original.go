@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"shareclip/env"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Download the original of a leased video
+func GET_Workers_Jobs_ID_Original(c *gin.Context) {
+	_, videoID, _, ok := workerLease(c)
+	if !ok {
+		return
+	}
+	size, err := env.Storage.Stat("video/" + videoID)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.AbortWithStatusJSON(http.StatusNotFound, "Original No Longer Available")
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	r, err := env.Storage.Get("video/" + videoID)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer r.Close()
+	c.DataFromReader(http.StatusOK, size, "application/octet-stream", r, nil)
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -134,13 +135,27 @@ func GET_oAuth2_Callback(c *gin.Context) {
 		return
 	}
 
+	// Check for Ban
+	var userBanned *string
+	err := env.DB.
+		QueryRow("SELECT banned FROM users WHERE id = $1", DiscordUser.ID).
+		Scan(&userBanned)
+	if err != nil && err != sql.ErrNoRows {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if userBanned != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, "Your account has been suspended: "+*userBanned)
+		return
+	}
+
 	// Upsert Discord User
 	userToken := tools.GenerateToken()
 	userName := DiscordUser.Username
 	if DiscordUser.Displayname != nil {
 		userName = *DiscordUser.Displayname
 	}
-	_, err := env.DB.Exec(
+	_, err = env.DB.Exec(
 		`INSERT INTO users 
 			(id, avatar, name, token) VALUES ($1, $2, $3, $4)
 		ON CONFLICT (id) DO UPDATE SET 
@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"os"
+	"shareclip/env"
+	"shareclip/tools"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Append a chunk to an incomplete upload
+//
+// The client must send the offset it believes the upload is at using the
+// "Upload-Offset" header, and may optionally send "Upload-Checksum: sha256 <base64>"
+// to have the chunk verified before it is accepted.
+func PATCH_Uploads_ID(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	uploadID := c.Param("id")
+
+	// Lock Upload
+	unlock, ok := uploadLock(uploadID)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusConflict, "Upload In Progress")
+		return
+	}
+	defer unlock()
+
+	// Lookup Upload
+	// Read while locked so the offset cannot change underneath us
+	var (
+		UploadSize     int64
+		UploadReceived int64
+	)
+	err := env.DB.
+		QueryRow("SELECT size, received FROM uploads WHERE id = $1 AND user_id = $2", uploadID, userSession.ID).
+		Scan(&UploadSize, &UploadReceived)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Upload")
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// Validate Headers
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Upload-Offset")
+		return
+	}
+	if offset != UploadReceived {
+		c.AbortWithStatusJSON(http.StatusConflict, "Offset Mismatch")
+		return
+	}
+	var expectedChecksum []byte
+	if header := c.GetHeader("Upload-Checksum"); header != "" {
+		algorithm, value, _ := strings.Cut(header, " ")
+		if algorithm != "sha256" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, "Unsupported Checksum Algorithm")
+			return
+		}
+		if expectedChecksum, err = base64.StdEncoding.DecodeString(value); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Upload-Checksum")
+			return
+		}
+	}
+	// Discard anything past the last acknowledged offset, this happens
+	// when the server was interrupted before it could record the chunk
+	f, err := os.OpenFile(uploadPartial(uploadID), os.O_WRONLY, env.FILE_MODE)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer f.Close()
+	if err := f.Truncate(UploadReceived); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if _, err := f.Seek(UploadReceived, io.SeekStart); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// Copy Chunk to Disk
+	hash := sha256.New()
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, UploadSize-UploadReceived)
+	written, errCopy := io.Copy(f, io.TeeReader(body, hash))
+	if errCopy != nil && expectedChecksum != nil {
+		// Partial chunks cannot be verified
+		f.Truncate(UploadReceived)
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Incomplete Chunk")
+		return
+	}
+	if expectedChecksum != nil && !bytes.Equal(hash.Sum(nil), expectedChecksum) {
+		f.Truncate(UploadReceived)
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Checksum Mismatch")
+		return
+	}
+	if err := f.Sync(); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// Record Progress
+	// Unverified chunks are kept even if the connection dropped part way
+	// through so the client can resume from wherever it was cut off
+	UploadReceived += written
+	if _, err := env.DB.Exec("UPDATE uploads SET received = $1 WHERE id = $2", UploadReceived, uploadID); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if errCopy != nil {
+		if _, ok := errCopy.(*http.MaxBytesError); ok {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, "Chunk Exceeds Upload Size")
+			return
+		}
+		c.AbortWithError(http.StatusBadRequest, errCopy)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":       uploadID,
+		"size":     UploadSize,
+		"received": UploadReceived,
+	})
+}
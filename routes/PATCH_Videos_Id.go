@@ -0,0 +1,166 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Update the metadata of a video owned by the currently logged in user
+func PATCH_Videos_ID(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+
+	// Validate Body
+	// Omitted fields are left unchanged
+	var Body struct {
+		Title       *string         `json:"title"`
+		Description *string         `json:"description"`
+		Visibility  *string         `json:"visibility"`
+		ExpiresIn   *int64          `json:"expires_in"` // Seconds until the video is deleted, 0 to use the default
+		TrimStart   *float64        `json:"trim_start"` // Seconds into the original to start from
+		TrimEnd     *float64        `json:"trim_end"`   // Seconds into the original to stop at, 0 keeps everything after the start
+		Audio       *env.VideoAudio `json:"audio"`      // Audio tracks to include from the original
+	}
+	if err := c.ShouldBindJSON(&Body); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Body")
+		return
+	}
+	if Body.Title != nil {
+		*Body.Title = strings.TrimSpace(*Body.Title)
+		if utf8.RuneCountInString(*Body.Title) > env.MAX_TITLE {
+			c.AbortWithStatusJSON(http.StatusBadRequest, "Title Too Long")
+			return
+		}
+	}
+	if Body.Description != nil {
+		*Body.Description = strings.TrimSpace(*Body.Description)
+		if utf8.RuneCountInString(*Body.Description) > env.MAX_DESCRIPTION {
+			c.AbortWithStatusJSON(http.StatusBadRequest, "Description Too Long")
+			return
+		}
+	}
+
+	if Body.Visibility != nil {
+		switch *Body.Visibility {
+		case "PUBLIC", "UNLISTED", "PRIVATE":
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Visibility")
+			return
+		}
+	}
+
+	if Body.ExpiresIn != nil && *Body.ExpiresIn < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Expiry")
+		return
+	}
+
+	if Body.Audio != nil && !Body.Audio.Valid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Audio")
+		return
+	}
+
+	// Trimming and audio only apply when the video is encoded, so they can only change before then
+	// The duration follows the trim, becoming unknown if the untrimmed duration is
+	retrim := Body.TrimStart != nil || Body.TrimEnd != nil
+	var VideoDuration *float64
+	if retrim || Body.Audio != nil {
+		var (
+			VideoStatus           string
+			VideoTrim             env.VideoTrim
+			VideoOriginalDuration *float64
+		)
+		err := env.DB.
+			QueryRow(
+				"SELECT status, trim_start, trim_end, original_duration FROM videos WHERE id = $1 AND user_id = $2",
+				c.Param("id"), userSession.ID,
+			).
+			Scan(&VideoStatus, &VideoTrim.Start, &VideoTrim.End, &VideoOriginalDuration)
+		switch {
+		case err == sql.ErrNoRows:
+			c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Video")
+			return
+		case err != nil:
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		case VideoStatus != "QUEUE" && VideoStatus != "ERROR":
+			c.AbortWithStatusJSON(http.StatusConflict, "Video Already Encoded")
+			return
+		}
+		if Body.TrimStart != nil {
+			VideoTrim.Start = *Body.TrimStart
+		}
+		if Body.TrimEnd != nil {
+			VideoTrim.End = *Body.TrimEnd
+		}
+		if !VideoTrim.Valid() {
+			c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Trim")
+			return
+		}
+		VideoDuration = trimmedDuration(VideoOriginalDuration, VideoTrim)
+	}
+
+	// Update Video
+	// The trim and audio are left alone if the video was claimed by an encoder since they were checked
+	var (
+		VideoID         string
+		VideoCreated    string
+		VideoStatus     string
+		VideoTitle      string
+		VideoDesc       string
+		VideoVisibility string
+		VideoExpires    *string
+		VideoTrim       env.VideoTrim
+		VideoAudio      env.VideoAudio
+	)
+	err := env.DB.
+		QueryRow(
+			`UPDATE videos SET
+				title = COALESCE($1, title),
+				description = COALESCE($2, description),
+				visibility = COALESCE($3, visibility),
+				expires = CASE
+					WHEN $4 IS NULL THEN expires
+					WHEN $4 = 0 THEN NULL
+					ELSE datetime('now', '+' || $4 || ' seconds')
+				END,
+				trim_start = CASE WHEN status IN ('QUEUE', 'ERROR') THEN COALESCE($5, trim_start) ELSE trim_start END,
+				trim_end = CASE WHEN status IN ('QUEUE', 'ERROR') THEN COALESCE($6, trim_end) ELSE trim_end END,
+				audio = CASE WHEN status IN ('QUEUE', 'ERROR') THEN COALESCE($7, audio) ELSE audio END,
+				duration = CASE WHEN status IN ('QUEUE', 'ERROR') AND $8 THEN $9 ELSE duration END
+			WHERE id = $10 AND user_id = $11
+			RETURNING id, created, status, title, description, visibility, trim_start, trim_end, audio, `+env.SQLExpires(),
+			Body.Title, Body.Description, Body.Visibility, Body.ExpiresIn, Body.TrimStart, Body.TrimEnd, Body.Audio, retrim, VideoDuration,
+			c.Param("id"), userSession.ID,
+		).
+		Scan(
+			&VideoID, &VideoCreated, &VideoStatus, &VideoTitle, &VideoDesc, &VideoVisibility,
+			&VideoTrim.Start, &VideoTrim.End, &VideoAudio, &VideoExpires,
+		)
+
+	switch {
+	case err == sql.ErrNoRows:
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Video")
+	case err != nil:
+		c.AbortWithError(http.StatusInternalServerError, err)
+	default:
+		video := gin.H{
+			"id":          VideoID,
+			"created":     VideoCreated,
+			"status":      VideoStatus,
+			"title":       VideoTitle,
+			"description": VideoDesc,
+			"visibility":  VideoVisibility,
+			"expires":     VideoExpires,
+			"trim_start":  VideoTrim.Start,
+			"trim_end":    VideoTrim.End,
+			"audio":       VideoAudio,
+		}
+		env.SendEvent(userSession.ID, "VIDEO_UPDATED", VideoID, video)
+		c.JSON(http.StatusOK, video)
+	}
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cross-check the database against storage, only reporting drift unless ?dry_run=false is given
+func POST_Admin_Reconcile(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	fix := c.Query("dry_run") == "false"
+	report, err := env.Reconcile(fix)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if fix {
+		log.Printf("[admin] %s reconciled storage\n", userSession.ID)
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Encode many videos again from their originals, such as after changing the encoder options
+// - Optional Body: {"user_id": "...", "status": "FINISH"}
+func POST_Admin_Reencode(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	var Body struct {
+		UserID string `json:"user_id"`
+		Status string `json:"status"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&Body); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Body")
+			return
+		}
+	}
+	if Body.Status != "" && Body.Status != "FINISH" && Body.Status != "ERROR" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Status")
+		return
+	}
+
+	queued, err := env.ReencodeVideos("", Body.UserID, Body.Status)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	log.Printf("[admin] %s queued %d videos for encoding\n", userSession.ID, len(queued))
+	c.JSON(http.StatusOK, queued)
+}
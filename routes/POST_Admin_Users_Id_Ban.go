@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ban a User, preventing them from logging in and ending their current session
+// Users that have never logged in can also be banned ahead of time
+func POST_Admin_Users_ID_Ban(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	var Body struct {
+		Reason       string `json:"reason"`
+		DeleteVideos bool   `json:"delete_videos"`
+	}
+	if err := c.ShouldBindJSON(&Body); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Body")
+		return
+	}
+	Body.Reason = strings.TrimSpace(Body.Reason)
+	if Body.Reason == "" {
+		Body.Reason = "No reason provided"
+	}
+	targetID := c.Param("id")
+	if env.ADMIN_USER_IDS[targetID] {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Cannot Ban an Administrator")
+		return
+	}
+
+	// Ban User
+	_, err := env.DB.Exec(
+		`INSERT INTO users (id, banned) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET banned = $2, token = NULL`,
+		targetID, Body.Reason,
+	)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// Delete their Videos
+	if Body.DeleteVideos {
+		rows, err := env.DB.Query("SELECT id FROM videos WHERE user_id = $1", targetID)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		videoIDs := []string{}
+		for rows.Next() {
+			var videoID string
+			if err := rows.Scan(&videoID); err != nil {
+				rows.Close()
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+			videoIDs = append(videoIDs, videoID)
+		}
+		rows.Close()
+		for _, videoID := range videoIDs {
+			if err := env.DeleteVideo(videoID); err != nil {
+				c.Error(err)
+			}
+		}
+	}
+
+	log.Printf("[admin] %s banned user %s: %s\n", userSession.ID, targetID, Body.Reason)
+	c.Status(http.StatusNoContent)
+}
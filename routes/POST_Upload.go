@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"encoding/json"
 	"io"
 	"mime"
 	"mime/multipart"
@@ -9,6 +10,8 @@ import (
 	"path"
 	"shareclip/env"
 	"shareclip/tools"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,17 +22,57 @@ var allowedExtensions = map[string]bool{
 	".mov":  true, // iphone
 }
 
+// Generate a Video Title from the Uploaded Filename
+func defaultTitle(filename string) string {
+	title := []rune(strings.TrimSpace(strings.TrimSuffix(filename, path.Ext(filename))))
+	if len(title) > env.MAX_TITLE {
+		title = title[:env.MAX_TITLE]
+	}
+	return string(title)
+}
+
+// Expected Length of a Video once Trimmed
+// - Trims outside of the video are left for the encoder to report
+func trimmedDuration(duration *float64, trim env.VideoTrim) *float64 {
+	if duration == nil || trim.Start >= *duration {
+		return duration
+	}
+	length := trim.Length(*duration)
+	return &length
+}
+
 // Upload and Queue a video for processing
 func POST_Upload(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+
+	// Enforce User Quotas
+	quota, err := env.GetQuota(userSession.ID)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if msg := quota.Check(max(c.Request.ContentLength, 0)); msg != "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, msg)
+		return
+	}
 
 	// Impose Body Size Limitations
-	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, env.MAX_FILE_SIZE)
+	uploadLimit := int64(env.MAX_FILE_SIZE)
+	if remaining := quota.Remaining(); remaining >= 0 {
+		uploadLimit = min(uploadLimit, remaining)
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, uploadLimit)
 	if c.Request.ContentLength > env.MAX_FILE_SIZE {
 		c.AbortWithStatusJSON(http.StatusBadRequest, "Payload Too Large")
 		return
 	}
 	formBoundary := ""
 	formFileCount := 0
+	formFileName := ""
+	formFileSize := int64(0)
+	formProfile := env.PROFILE_DEFAULT
+	formTrim := env.VideoTrim{}
+	formAudio := env.VideoAudio{}
 	if _, params, err := mime.ParseMediaType(c.GetHeader("Content-Type")); err != nil || params["boundary"] == "" {
 		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Content-Type")
 		return
@@ -39,9 +82,8 @@ func POST_Upload(c *gin.Context) {
 
 	// Initialize Upload Directory
 	var (
-		userSession    = c.MustGet("user").(tools.RequestUser)
 		uploadID       = tools.GenerateVideoID()
-		uploadPath     = path.Join(env.DATA_DIR, "video", uploadID)
+		uploadPath     = uploadPartial(uploadID)
 		uploadComplete = false
 		uploadForm     = multipart.NewReader(c.Request.Body, formBoundary)
 	)
@@ -91,6 +133,7 @@ func POST_Upload(c *gin.Context) {
 				continue
 			}
 			formFileCount++
+			formFileName = formPart.FileName()
 
 			// Copy File to Disk
 			f, err := os.OpenFile(uploadPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, env.FILE_MODE)
@@ -99,10 +142,55 @@ func POST_Upload(c *gin.Context) {
 				continue
 			}
 			defer f.Close()
-			if _, err := io.Copy(f, formPart); err != nil {
+			formFileSize, err = io.Copy(f, formPart)
+			if _, ok := err.(*http.MaxBytesError); ok {
+				errorClient = "Payload Too Large"
+				continue
+			}
+			if err != nil {
+				errorServer = err
+				continue
+			}
+
+		case formPart.FormName() == "profile":
+			b, err := io.ReadAll(io.LimitReader(formPart, 256))
+			if err != nil {
 				errorServer = err
 				continue
 			}
+			if _, ok := env.ENCODER_PROFILES[string(b)]; !ok {
+				errorClient = "Invalid Profile"
+				continue
+			}
+			formProfile = string(b)
+
+		case formPart.FormName() == "audio":
+			b, err := io.ReadAll(io.LimitReader(formPart, 4096))
+			if err != nil {
+				errorServer = err
+				continue
+			}
+			if err := json.Unmarshal(b, &formAudio); err != nil || !formAudio.Valid() {
+				errorClient = "Invalid Audio"
+				continue
+			}
+
+		case formPart.FormName() == "trim_start", formPart.FormName() == "trim_end":
+			b, err := io.ReadAll(io.LimitReader(formPart, 64))
+			if err != nil {
+				errorServer = err
+				continue
+			}
+			seconds, err := strconv.ParseFloat(string(b), 64)
+			if err != nil {
+				errorClient = "Invalid Trim"
+				continue
+			}
+			if formPart.FormName() == "trim_start" {
+				formTrim.Start = seconds
+			} else {
+				formTrim.End = seconds
+			}
 
 		default:
 			errorClient = "Invalid Form Body"
@@ -112,13 +200,20 @@ func POST_Upload(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, "No Video Uploaded")
 		return
 	}
+	if !formTrim.Valid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Trim")
+		return
+	}
 
 	// Queue Video for Encoding
-	_, err := env.DB.Exec(
-		"INSERT INTO videos (id, user_id, status) VALUES ($1, $2, 'QUEUE')",
-		uploadID, userSession.ID,
-	)
-	if err != nil {
+	// The duration is read early so short clips can skip ahead in the queue
+	uploadDuration := env.ProbeDuration(uploadPath)
+	if err := env.StoragePutFile("video/"+uploadID, uploadPath); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if err := queueUpload(uploadID, userSession.ID, formFileName, formProfile, formTrim, formAudio, formFileSize, uploadDuration); err != nil {
+		env.Storage.Delete("video/" + uploadID)
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
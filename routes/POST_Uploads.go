@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"shareclip/env"
+	"shareclip/tools"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Prevents the same upload from being written to by multiple requests at once
+var (
+	uploadLocks      = map[string]bool{}
+	uploadLocksMutex sync.Mutex
+)
+
+// Lock an Upload for Writing, returns false if another request is using it
+// - Uploads are only tracked while locked so finished and abandoned uploads leave nothing behind
+func uploadLock(uploadID string) (func(), bool) {
+	uploadLocksMutex.Lock()
+	defer uploadLocksMutex.Unlock()
+	if uploadLocks[uploadID] {
+		return nil, false
+	}
+	uploadLocks[uploadID] = true
+	return func() {
+		uploadLocksMutex.Lock()
+		delete(uploadLocks, uploadID)
+		uploadLocksMutex.Unlock()
+	}, true
+}
+
+// Path to the Incomplete File for an Upload
+func uploadPartial(uploadID string) string {
+	return path.Join(env.DATA_DIR, "video", uploadID+".part")
+}
+
+// Begin a Resumable Upload
+func POST_Uploads(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+
+	// Validate Upload Details
+	var Body struct {
+		Filename  string         `json:"filename"`
+		Size      int64          `json:"size"`
+		Profile   string         `json:"profile"`
+		TrimStart float64        `json:"trim_start"` // Seconds into the Video to start from
+		TrimEnd   float64        `json:"trim_end"`   // Seconds into the Video to stop at, 0 keeps everything after the start
+		Audio     env.VideoAudio `json:"audio"`
+	}
+	if err := c.ShouldBindJSON(&Body); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Body")
+		return
+	}
+	if Body.Size <= 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid File Size")
+		return
+	}
+	if Body.Size > env.MAX_FILE_SIZE {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Payload Too Large")
+		return
+	}
+	if _, ok := allowedExtensions[path.Ext(Body.Filename)]; !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid File Type")
+		return
+	}
+	if Body.Profile == "" {
+		Body.Profile = env.PROFILE_DEFAULT
+	}
+	if _, ok := env.ENCODER_PROFILES[Body.Profile]; !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Profile")
+		return
+	}
+	if !(env.VideoTrim{Start: Body.TrimStart, End: Body.TrimEnd}).Valid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Trim")
+		return
+	}
+	if !Body.Audio.Valid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Audio")
+		return
+	}
+
+	// Enforce User Quotas
+	quota, err := env.GetQuota(userSession.ID)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if msg := quota.Check(Body.Size); msg != "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, msg)
+		return
+	}
+
+	// Create Empty File on Disk
+	uploadID := tools.GenerateVideoID()
+	f, err := os.OpenFile(uploadPartial(uploadID), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, env.FILE_MODE)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	f.Close()
+
+	// Track Upload Progress
+	_, err = env.DB.Exec(
+		`INSERT INTO uploads (id, user_id, filename, size, profile, trim_start, trim_end, audio)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		uploadID, userSession.ID, Body.Filename, Body.Size, Body.Profile, Body.TrimStart, Body.TrimEnd, Body.Audio,
+	)
+	if err != nil {
+		os.Remove(uploadPartial(uploadID))
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":       uploadID,
+		"size":     Body.Size,
+		"received": 0,
+	})
+}
@@ -0,0 +1,129 @@
+package routes
+
+import (
+	"database/sql"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"shareclip/env"
+	"shareclip/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Insert the Video, Record the Upload and Remove any Resumable Upload in a single Transaction
+// - The duration is of the original, the untrimmed duration is kept so the trim can be changed later
+func queueUpload(uploadID, userID, filename, profile string, trim env.VideoTrim, audio env.VideoAudio, size int64, duration *float64) error {
+	tx, err := env.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(
+		`INSERT INTO videos (id, user_id, status, title, size, duration, original_duration, profile, trim_start, trim_end, audio)
+		VALUES ($1, $2, 'QUEUE', $3, $4, $5, $6, $7, $8, $9, $10)`,
+		uploadID, userID, defaultTitle(filename), size, trimmedDuration(duration, trim), duration, profile, trim.Start, trim.End, audio,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM uploads WHERE id = $1", uploadID); err != nil {
+		return err
+	}
+	if err := env.RecordUpload(tx, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Verify a completed upload and Queue it for processing
+func POST_Uploads_ID_Finalize(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	uploadID := c.Param("id")
+
+	// Lock Upload
+	unlock, ok := uploadLock(uploadID)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusConflict, "Upload In Progress")
+		return
+	}
+	defer unlock()
+
+	// Lookup Upload
+	// Read while locked so chunks still being written are accounted for
+	var (
+		UploadFilename string
+		UploadSize     int64
+		UploadReceived int64
+		UploadProfile  string
+		UploadTrim     env.VideoTrim
+		UploadAudio    env.VideoAudio
+	)
+	err := env.DB.
+		QueryRow(
+			"SELECT filename, size, received, profile, trim_start, trim_end, audio FROM uploads WHERE id = $1 AND user_id = $2",
+			uploadID, userSession.ID,
+		).
+		Scan(&UploadFilename, &UploadSize, &UploadReceived, &UploadProfile, &UploadTrim.Start, &UploadTrim.End, &UploadAudio)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Upload")
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// Verify Upload
+	if UploadReceived != UploadSize {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Upload Incomplete")
+		return
+	}
+	// A previous attempt may have already moved the original into storage before failing to queue it
+	partialPath := uploadPartial(uploadID)
+	originalKey := "video/" + uploadID
+	var OriginalSize int64
+	s, err := os.Stat(partialPath)
+	stored := errors.Is(err, fs.ErrNotExist)
+	if stored {
+		OriginalSize, err = env.Storage.Stat(originalKey)
+	} else if err == nil {
+		OriginalSize = s.Size()
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if OriginalSize != UploadSize {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, "Upload Corrupted")
+		return
+	}
+	var uploadDuration *float64
+	if stored {
+		localPath, cleanup, err := env.StorageFetch(originalKey)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		uploadDuration = env.ProbeDuration(localPath)
+		cleanup()
+	} else {
+		uploadDuration = env.ProbeDuration(partialPath)
+		if err := env.StoragePutFile(originalKey, partialPath); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	// Queue Video for Encoding
+	// On failure the upload and its original are kept so finalizing can be retried,
+	// abandoned ones are cleaned up once they expire
+	if err := queueUpload(uploadID, userSession.ID, UploadFilename, UploadProfile, UploadTrim, UploadAudio, UploadSize, uploadDuration); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	env.WakeEncoder()
+
+	// Return Video ID
+	c.JSON(http.StatusCreated, uploadID)
+}
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Encode a video again from its original, usable by the owner or an administrator
+func POST_Videos_ID_Reencode(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	var (
+		VideoOwner    string
+		VideoStatus   string
+		VideoOriginal bool
+	)
+	err := env.DB.
+		QueryRow("SELECT user_id, status, original FROM videos WHERE id = $1", c.Param("id")).
+		Scan(&VideoOwner, &VideoStatus, &VideoOriginal)
+	switch {
+	case err == sql.ErrNoRows, err == nil && VideoOwner != userSession.ID && !userSession.Admin:
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Video")
+		return
+	case err != nil:
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	case VideoStatus == "QUEUE" || VideoStatus == "PROCESS":
+		c.AbortWithStatusJSON(http.StatusConflict, "Video Already Queued")
+		return
+	case !VideoOriginal:
+		c.AbortWithStatusJSON(http.StatusConflict, "Original No Longer Available")
+		return
+	}
+
+	queued, err := env.ReencodeVideos(c.Param("id"), "", "")
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if len(queued) == 0 {
+		// Status changed since we looked
+		c.AbortWithStatusJSON(http.StatusConflict, "Video Already Queued")
+		return
+	}
+	if VideoOwner != userSession.ID {
+		log.Printf("[admin] %s queued video %s for encoding\n", userSession.ID, c.Param("id"))
+	}
+	c.Status(http.StatusNoContent)
+}
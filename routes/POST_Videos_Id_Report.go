@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Report a video to the administrators, viewers do not need to be logged in
+func POST_Videos_ID_Report(c *gin.Context) {
+	var Body struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+	if err := c.ShouldBindJSON(&Body); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Body")
+		return
+	}
+	if !env.REPORT_REASONS[Body.Reason] {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Reason")
+		return
+	}
+	Body.Details = strings.TrimSpace(Body.Details)
+	if utf8.RuneCountInString(Body.Details) > env.MAX_REPORT {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Details Too Long")
+		return
+	}
+
+	// Anonymous Reports are tracked by IP Address only
+	var ReporterID *string
+	if u, ok := tools.GetUser(c); ok {
+		ReporterID = &u.ID
+	}
+	ReporterIP := c.ClientIP()
+
+	// Lookup Video
+	var VideoID, VideoOwner, VideoModeration string
+	err := env.DB.
+		QueryRow("SELECT id, user_id, moderation FROM videos WHERE id = $1 AND published = 1", c.Param("id")).
+		Scan(&VideoID, &VideoOwner, &VideoModeration)
+	switch {
+	case err == sql.ErrNoRows, err == nil && (VideoModeration == "HIDDEN" || VideoModeration == "REMOVED"):
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Video")
+		return
+	case err != nil:
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// Ignore Duplicate Reports from the same Person
+	var Duplicate bool
+	err = env.DB.
+		QueryRow(
+			`SELECT EXISTS (
+				SELECT 1 FROM reports
+				WHERE video_id = $1 AND resolved = 0 AND (ip = $2 OR user_id = $3)
+			)`,
+			VideoID, ReporterIP, ReporterID,
+		).
+		Scan(&Duplicate)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if Duplicate {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	// Submit Report and Flag Video for Review
+	tx, err := env.DB.Begin()
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(
+		"INSERT INTO reports (video_id, user_id, ip, reason, details) VALUES ($1, $2, $3, $4, $5)",
+		VideoID, ReporterID, ReporterIP, Body.Reason, Body.Details,
+	); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if _, err := tx.Exec("UPDATE videos SET moderation = 'REVIEW' WHERE id = $1 AND moderation = 'NONE'", VideoID); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// Hide Video until Reviewed if enough people have reported it
+	// Reviewing restores the video by resolving its reports, unlike a takedown which removes it
+	hidden := false
+	if env.REPORTS_AUTO_HIDE > 0 {
+		var Reporters int
+		err := tx.
+			QueryRow(
+				"SELECT COUNT(DISTINCT COALESCE(user_id, ip)) FROM reports WHERE video_id = $1 AND resolved = 0",
+				VideoID,
+			).
+			Scan(&Reporters)
+		if err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		if Reporters >= env.REPORTS_AUTO_HIDE {
+			if _, err := tx.Exec("UPDATE videos SET moderation = 'HIDDEN' WHERE id = $1 AND moderation = 'REVIEW'", VideoID); err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+			hidden = true
+			log.Printf("[reports] Video %s hidden after %d reports\n", VideoID, Reporters)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if hidden {
+		env.SendEvent(VideoOwner, "VIDEO_MODERATED", VideoID, "HIDDEN")
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"shareclip/env"
+	"shareclip/tools"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Create a signed link that grants temporary access to a video owned by the currently logged in user
+func POST_Videos_ID_Shares(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	var Body struct {
+		ExpiresIn int64 `json:"expires_in"` // Seconds until the link expires
+		MaxViews  *int  `json:"max_views"`  // Optional: Amount of times the link can be opened
+	}
+	if err := c.ShouldBindJSON(&Body); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Body")
+		return
+	}
+	lifetime := time.Duration(Body.ExpiresIn) * time.Second
+	if lifetime < time.Minute || lifetime > env.SHARE_MAX_LIFETIME {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Expiry")
+		return
+	}
+	if Body.MaxViews != nil && *Body.MaxViews < 1 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid View Limit")
+		return
+	}
+
+	// Lookup Video
+	var VideoID, VideoShareKey string
+	err := env.DB.
+		QueryRow("SELECT id, share_key FROM videos WHERE id = $1 AND user_id = $2", c.Param("id"), userSession.ID).
+		Scan(&VideoID, &VideoShareKey)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Video")
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	// Track Views for Limited Links
+	var ShareID string
+	if Body.MaxViews != nil {
+		ShareID = tools.GenerateVideoID()
+		if _, err := env.DB.Exec(
+			"INSERT INTO shares (id, video_id, max_views) VALUES ($1, $2, $3)",
+			ShareID, VideoID, *Body.MaxViews,
+		); err != nil {
+			c.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	expires := time.Now().Add(lifetime)
+	token := env.SignShare(VideoID, VideoShareKey, ShareID, expires)
+	c.JSON(http.StatusCreated, gin.H{
+		"url":       "https://" + c.Request.Host + "/" + VideoID + "?share=" + url.QueryEscape(token),
+		"token":     token,
+		"expires":   expires.UTC().Format(time.DateTime),
+		"max_views": Body.MaxViews,
+	})
+}
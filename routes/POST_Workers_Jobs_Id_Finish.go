@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"shareclip/env"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Record the outcome of a leased video once its outputs were uploaded
+func POST_Workers_Jobs_ID_Finish(c *gin.Context) {
+	jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Job ID")
+		return
+	}
+	var Body env.WorkerResult
+	if err := c.ShouldBindJSON(&Body); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Body")
+		return
+	}
+	err = env.FinishLease(jobID, Body)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(http.StatusGone, "Lease Expired")
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
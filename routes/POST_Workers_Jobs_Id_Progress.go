@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"net/http"
+	"shareclip/env"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Renew the lease of a video and relay its progress to the owner
+func POST_Workers_Jobs_ID_Progress(c *gin.Context) {
+	var Body struct {
+		Percent string `json:"percent"`
+	}
+	if err := c.ShouldBindJSON(&Body); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Body")
+		return
+	}
+	if _, err := strconv.Atoi(Body.Percent); Body.Percent != "" && err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Percent")
+		return
+	}
+	_, videoID, userID, ok := workerLease(c)
+	if !ok {
+		return
+	}
+	if Body.Percent != "" {
+		env.SendEvent(userID, "VIDEO_PROCESSING_PROGRESS", videoID, Body.Percent)
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"shareclip/env"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Renew the Lease of the Job in the URL, returns false if the request was aborted
+func workerLease(c *gin.Context) (jobID int64, videoID, userID string, ok bool) {
+	jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Job ID")
+		return
+	}
+	videoID, userID, err = env.RenewLease(jobID)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(http.StatusGone, "Lease Expired")
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	return jobID, videoID, userID, true
+}
+
+// Lease the next queued video to a remote worker
+func POST_Workers_Lease(c *gin.Context) {
+	var Body struct {
+		Worker string `json:"worker"`
+		Codec  string `json:"codec"`
+	}
+	if err := c.ShouldBindJSON(&Body); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Body")
+		return
+	}
+	if Body.Worker == "" || len(Body.Worker) > 100 || Body.Codec == "" || len(Body.Codec) > 100 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Body")
+		return
+	}
+	lease, err := env.LeaseVideo(Body.Worker, Body.Codec)
+	if err == sql.ErrNoRows {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusCreated, lease)
+}
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"shareclip/env"
+	"shareclip/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Take down or restore a video, resolving all of its open reports
+func PUT_Admin_Videos_ID_Moderation(c *gin.Context) {
+	userSession := c.MustGet("user").(tools.RequestUser)
+	var Body struct {
+		Moderation string `json:"moderation"`
+	}
+	if err := c.ShouldBindJSON(&Body); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Body")
+		return
+	}
+	if Body.Moderation != "NONE" && Body.Moderation != "REMOVED" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Moderation State")
+		return
+	}
+
+	// Update Video and Resolve Reports
+	tx, err := env.DB.Begin()
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback()
+	var VideoOwner string
+	err = tx.
+		QueryRow("UPDATE videos SET moderation = $1 WHERE id = $2 RETURNING user_id", Body.Moderation, c.Param("id")).
+		Scan(&VideoOwner)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(http.StatusNotFound, "Unknown Video")
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if _, err := tx.Exec("UPDATE reports SET resolved = 1 WHERE video_id = $1", c.Param("id")); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Printf("[admin] %s set moderation of video %s to %s\n", userSession.ID, c.Param("id"), Body.Moderation)
+	env.SendEvent(VideoOwner, "VIDEO_MODERATED", c.Param("id"), Body.Moderation)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"net/http"
+	"shareclip/env"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Upload an output of a leased video, outputs are staged as soon as they are received and published once the lease finishes
+func PUT_Workers_Jobs_ID_Files(c *gin.Context) {
+	filename := strings.TrimPrefix(c.Param("file"), "/")
+	if filename == "" || strings.HasPrefix(filename, ".") || strings.ContainsAny(filename, `/\`) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, "Invalid Filename")
+		return
+	}
+	if c.Request.ContentLength <= 0 {
+		c.AbortWithStatusJSON(http.StatusLengthRequired, "Length Required")
+		return
+	}
+	if c.Request.ContentLength > env.MAX_FILE_SIZE {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, "Payload Too Large")
+		return
+	}
+	_, videoID, _, ok := workerLease(c)
+	if !ok {
+		return
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, c.Request.ContentLength)
+	if err := env.Storage.Put("pending/"+videoID+"/"+filename, body, c.Request.ContentLength); err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
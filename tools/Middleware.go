@@ -1,12 +1,17 @@
 package tools
 
 import (
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"shareclip/env"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,6 +22,7 @@ type RequestUser struct {
 	ID     string  `json:"id"`     // Their Discord ID
 	Avatar *string `json:"avatar"` // Their Discord Avatar Hash
 	Name   string  `json:"name"`   // Their Discord Username/Displayname
+	Admin  bool    `json:"admin"`  // Are they an Administrator?
 }
 
 // Lookup the User via their Session Cookie
@@ -35,14 +41,12 @@ func Session(c *gin.Context) {
 	}
 
 	// Lookup User via Cookie
-	var user RequestUser
-	err = env.DB.
-		QueryRow("SELECT id, avatar, name FROM users WHERE token = $1", token).
-		Scan(&user.ID, &user.Avatar, &user.Name)
-
+	user, err := lookupUser(token)
 	switch {
 	case err == sql.ErrNoRows:
 		c.AbortWithStatusJSON(http.StatusUnauthorized, "Unauthorized")
+	case err == errSuspended:
+		c.AbortWithStatusJSON(http.StatusForbidden, "Account Suspended")
 	case err != nil:
 		c.AbortWithError(http.StatusInternalServerError, err)
 	default:
@@ -50,6 +54,95 @@ func Session(c *gin.Context) {
 	}
 }
 
+// Lookup the User via their Session Cookie if they sent one, otherwise continue anonymously
+func SessionOptional(c *gin.Context) {
+	token, err := c.Cookie("session")
+	if err != nil {
+		return
+	}
+	user, err := lookupUser(token)
+	switch {
+	case err == sql.ErrNoRows, err == errSuspended:
+	case err != nil:
+		c.AbortWithError(http.StatusInternalServerError, err)
+	default:
+		c.Set("user", user)
+	}
+}
+
+var errSuspended = errors.New("account suspended")
+
+// Find the User for a Session Token
+func lookupUser(token string) (RequestUser, error) {
+	var user RequestUser
+	var banned *string
+	err := env.DB.
+		QueryRow("SELECT id, avatar, name, banned FROM users WHERE token = $1", token).
+		Scan(&user.ID, &user.Avatar, &user.Name, &banned)
+	if err != nil {
+		return user, err
+	}
+	if banned != nil {
+		return user, errSuspended
+	}
+	user.Admin = env.ADMIN_USER_IDS[user.ID]
+	return user, nil
+}
+
+// Fetch the Current User, if any
+func GetUser(c *gin.Context) (RequestUser, bool) {
+	v, ok := c.Get("user")
+	if !ok {
+		return RequestUser{}, false
+	}
+	u, ok := v.(RequestUser)
+	return u, ok
+}
+
+// Only allow Administrators to continue, must be used after Session
+func Admin(c *gin.Context) {
+	if !c.MustGet("user").(RequestUser).Admin {
+		c.AbortWithStatusJSON(http.StatusForbidden, "Forbidden")
+	}
+}
+
+// Only allow Remote Workers with the Shared Secret to continue
+func Worker(c *gin.Context) {
+	if env.WORKER_SECRET == "" {
+		c.AbortWithStatusJSON(http.StatusNotFound, "Remote Workers Disabled")
+		return
+	}
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(env.WORKER_SECRET)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, "Unauthorized")
+	}
+}
+
+// Limit how many requests each client can make within a window of time
+func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
+	var (
+		mutex sync.Mutex
+		hits  = map[string]int{}
+		reset = time.Now().Add(window)
+	)
+	return func(c *gin.Context) {
+		mutex.Lock()
+		if time.Now().After(reset) {
+			hits = map[string]int{}
+			reset = time.Now().Add(window)
+		}
+		hits[c.ClientIP()]++
+		count := hits[c.ClientIP()]
+		retryAfter := time.Until(reset)
+		mutex.Unlock()
+
+		if count > limit {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, "Too Many Requests")
+		}
+	}
+}
+
 // Logs Requests to the Application Log
 func Logger(c *gin.Context) {
 	var RequestStart = time.Now()
@@ -71,10 +164,8 @@ func Logger(c *gin.Context) {
 
 	// Retrieve User ID (if logged in)
 	var UserID string
-	if v, ok := c.Get("user"); ok {
-		if u, ok := v.(RequestUser); ok {
-			UserID = u.ID
-		}
+	if u, ok := GetUser(c); ok {
+		UserID = u.ID
 	}
 
 	// Log Request to Console